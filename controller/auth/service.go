@@ -21,6 +21,12 @@ type Service interface {
 	Authorize(models.Request) (*models.AuthorizationInfo, error)
 }
 
+// SignatureVerifier is implemented by services verifying the signature of the client, the client
+// ID of the requests they authorize is genuine.
+type SignatureVerifier interface {
+	VerifiesSignature() bool
+}
+
 type authService struct {
 	method        string
 	signingKey    []byte
@@ -32,6 +38,10 @@ func NewService(method, signingKey string, compositeRepo repo.CompositeRepositor
 	return authService{method, []byte(signingKey), compositeRepo, useSignature}
 }
 
+func (svc authService) VerifiesSignature() bool {
+	return svc.useSignature
+}
+
 func (svc authService) Authorize(request models.Request) (*models.AuthorizationInfo, error) {
 	var (
 		userID          string
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"fmt"
+
 	"github.com/uzzeet/uzzeet-gateway/controller/resolver"
 
 	"github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
@@ -72,12 +73,215 @@ func (g *Gateway) Open() error {
 				}
 
 				logger.Infof("service %s successful registered.", cfg.Key)
-				if cfg.TypeConn != "http" {
-					fwd.Mount(c)
-				}
+				fwd.Mount(c)
 			}(cfg)
 		}
 	}(ch, g.fwd)
 
+	err = g.openRemovals()
+	if err != nil {
+		return err
+	}
+
+	err = g.openTraffic()
+	if err != nil {
+		return err
+	}
+
+	err = g.openScripts()
+	if err != nil {
+		return err
+	}
+
+	err = g.openAggregates()
+	if err != nil {
+		return err
+	}
+
+	return g.openQuotas()
+}
+
+// openRemovals unmounts the services removed from the registry, it's a no-op unless the registry
+// supports removals.
+func (g *Gateway) openRemovals() error {
+	remover, ok := g.reg.(service.RegistryRemover)
+	if !ok {
+		return nil
+	}
+
+	ch, err := remover.WatchRemovals()
+	if err != nil {
+		return err
+	}
+
+	go func(ch <-chan string, fwd service.Forwarder) {
+		for key := range ch {
+			logger.Infof("service %s is removed", key)
+			fwd.Unmount(key)
+		}
+	}(ch, g.fwd)
+
+	return nil
+}
+
+// openTraffic applies the traffic policies of the registry and keeps them up to date, it's a no-op
+// unless both the registry and the forwarder support traffic splitting.
+func (g *Gateway) openTraffic() error {
+	reader, ok := g.reg.(service.TrafficReader)
+	if !ok {
+		return nil
+	}
+
+	splitter, ok := g.fwd.(service.TrafficSplitter)
+	if !ok {
+		return nil
+	}
+
+	policies, err := reader.GetTraffic()
+	if err != nil {
+		return fmt.Errorf("while reading traffic policies from registry: %v", err)
+	}
+
+	for _, policy := range policies {
+		splitter.Split(policy)
+	}
+
+	ch, err := reader.WatchTraffic()
+	if err != nil {
+		return err
+	}
+
+	go func(ch <-chan service.TrafficPolicy) {
+		for policy := range ch {
+			splitter.Split(policy)
+		}
+	}(ch)
+
+	return nil
+}
+
+// openScripts loads the policy scripts of the registry and reloads them whenever they change, it's
+// a no-op unless both the registry and the forwarder support scripts.
+func (g *Gateway) openScripts() error {
+	reader, ok := g.reg.(service.ScriptReader)
+	if !ok {
+		return nil
+	}
+
+	loader, ok := g.fwd.(service.ScriptLoader)
+	if !ok {
+		return nil
+	}
+
+	scripts, err := reader.GetScripts()
+	if err != nil {
+		return fmt.Errorf("while reading scripts from registry: %v", err)
+	}
+
+	for _, script := range scripts {
+		err := loader.LoadScript(script)
+		if err != nil {
+			logger.Err(serror.NewFromErrorc(err, fmt.Sprintf("while loading script %s", script.Name)))
+		}
+	}
+
+	ch, err := reader.WatchScripts()
+	if err != nil {
+		return err
+	}
+
+	go func(ch <-chan service.Script) {
+		for script := range ch {
+			err := loader.LoadScript(script)
+			if err != nil {
+				logger.Err(serror.NewFromErrorc(err, fmt.Sprintf("while loading script %s", script.Name)))
+			}
+		}
+	}(ch)
+
+	return nil
+}
+
+// openAggregates serves the aggregates of the registry and keeps them up to date, it's a no-op
+// unless both the registry and the forwarder support aggregates.
+func (g *Gateway) openAggregates() error {
+	reader, ok := g.reg.(service.AggregateReader)
+	if !ok {
+		return nil
+	}
+
+	aggregator, ok := g.fwd.(service.Aggregator)
+	if !ok {
+		return nil
+	}
+
+	aggregates, err := reader.GetAggregates()
+	if err != nil {
+		return fmt.Errorf("while reading aggregates from registry: %v", err)
+	}
+
+	for _, aggregate := range aggregates {
+		err := aggregator.Aggregate(aggregate)
+		if err != nil {
+			logger.Err(serror.NewFromErrorc(err, fmt.Sprintf("while serving aggregate %s", aggregate.Name)))
+		}
+	}
+
+	ch, err := reader.WatchAggregates()
+	if err != nil {
+		return err
+	}
+
+	go func(ch <-chan service.Aggregate) {
+		for aggregate := range ch {
+			err := aggregator.Aggregate(aggregate)
+			if err != nil {
+				logger.Err(serror.NewFromErrorc(err, fmt.Sprintf("while serving aggregate %s", aggregate.Name)))
+			}
+		}
+	}(ch)
+
+	return nil
+}
+
+// openQuotas enforces the quotas of the registry and keeps them up to date, it's a no-op unless
+// both the registry and the forwarder support quotas.
+func (g *Gateway) openQuotas() error {
+	reader, ok := g.reg.(service.QuotaReader)
+	if !ok {
+		return nil
+	}
+
+	enforcer, ok := g.fwd.(service.QuotaEnforcer)
+	if !ok {
+		return nil
+	}
+
+	quotas, err := reader.GetQuotas()
+	if err != nil {
+		return fmt.Errorf("while reading quotas from registry: %v", err)
+	}
+
+	for _, quota := range quotas {
+		err := enforcer.Quota(quota)
+		if err != nil {
+			logger.Err(serror.NewFromErrorc(err, fmt.Sprintf("while enforcing quota of %s", quota.Subject())))
+		}
+	}
+
+	ch, err := reader.WatchQuotas()
+	if err != nil {
+		return err
+	}
+
+	go func(ch <-chan service.Quota) {
+		for quota := range ch {
+			err := enforcer.Quota(quota)
+			if err != nil {
+				logger.Err(serror.NewFromErrorc(err, fmt.Sprintf("while enforcing quota of %s", quota.Subject())))
+			}
+		}
+	}(ch)
+
 	return nil
 }
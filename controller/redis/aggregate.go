@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"encoding/json"
+
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+func (reg Registry) aggregates() hashStore {
+	return reg.store("aggregates")
+}
+
+// WriteAggregate stores the aggregate and notifies running gateways, an aggregate without calls is
+// removed.
+func (reg Registry) WriteAggregate(aggregate service.Aggregate) error {
+	err := aggregate.Validate()
+	if err != nil {
+		return err
+	}
+
+	return reg.aggregates().write(aggregate.Name, aggregate, aggregate.IsActive())
+}
+
+func (reg Registry) GetAggregates() ([]service.Aggregate, error) {
+	aggregates := []service.Aggregate{}
+	err := reg.aggregates().each(func(b []byte) error {
+		var aggregate service.Aggregate
+
+		err := json.Unmarshal(b, &aggregate)
+		aggregates = append(aggregates, aggregate)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return aggregates, nil
+}
+
+func (reg Registry) WatchAggregates() (<-chan service.Aggregate, error) {
+	rc := make(chan service.Aggregate)
+	reg.aggregates().watch(func(b []byte) error {
+		var aggregate service.Aggregate
+
+		err := json.Unmarshal(b, &aggregate)
+		if err == nil {
+			rc <- aggregate
+		}
+		return err
+	})
+
+	return rc, nil
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	redis "github.com/go-redis/redis/v7"
+)
+
+// ResponseCache is a service.ResponseCache shared by every gateway using the same redis.
+type ResponseCache struct {
+	key  string
+	conn *Connection
+}
+
+func NewResponseCache(key string, conn *Connection) *ResponseCache {
+	return &ResponseCache{fmt.Sprintf("%s:cache:", key), conn}
+}
+
+func (rc ResponseCache) Get(key string) ([]byte, bool, error) {
+	res, err := rc.conn.Get(rc.key + key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("while reading from redis: %v", err)
+	}
+
+	return res, true, nil
+}
+
+func (rc ResponseCache) Set(key string, value []byte, ttl time.Duration) error {
+	_, err := rc.conn.Set(rc.key+key, value, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("while writing to redis: %v", err)
+	}
+
+	return nil
+}
+
+// Purge deletes the keys starting with the prefix, they're scanned so that redis isn't blocked.
+func (rc ResponseCache) Purge(prefix string) (int, error) {
+	var cursor uint64
+
+	count := 0
+	match := escapeGlob(rc.key+prefix) + "*"
+	for {
+		keys, next, err := rc.conn.Scan(cursor, match, 500).Result()
+		if err != nil {
+			return count, fmt.Errorf("while scanning redis: %v", err)
+		}
+
+		if len(keys) > 0 {
+			n, err := rc.conn.Del(keys...).Result()
+			if err != nil {
+				return count, fmt.Errorf("while deleting from redis: %v", err)
+			}
+
+			count += int(n)
+		}
+
+		if next == 0 {
+			return count, nil
+		}
+		cursor = next
+	}
+}
+
+func escapeGlob(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(pattern)
+}
@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	redis "github.com/go-redis/redis/v7"
+)
+
+// IdempotencyStore is a service.IdempotencyStore shared by every gateway using the same redis.
+type IdempotencyStore struct {
+	key  string
+	conn *Connection
+}
+
+func NewIdempotencyStore(key string, conn *Connection) *IdempotencyStore {
+	return &IdempotencyStore{fmt.Sprintf("%s:idempotency:", key), conn}
+}
+
+// Reserve sets the record unless the key exists, a key expiring between both commands is
+// reserved again.
+func (is IdempotencyStore) Reserve(key string, record []byte, ttl time.Duration) ([]byte, bool, error) {
+	for {
+		ok, err := is.conn.SetNX(is.key+key, record, ttl).Result()
+		if err != nil {
+			return nil, false, fmt.Errorf("while writing to redis: %v", err)
+		}
+
+		if ok {
+			return nil, true, nil
+		}
+
+		res, err := is.conn.Get(is.key + key).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+
+		if err != nil {
+			return nil, false, fmt.Errorf("while reading from redis: %v", err)
+		}
+
+		return res, false, nil
+	}
+}
+
+func (is IdempotencyStore) Complete(key string, record []byte, ttl time.Duration) error {
+	_, err := is.conn.Set(is.key+key, record, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("while writing to redis: %v", err)
+	}
+
+	return nil
+}
+
+func (is IdempotencyStore) Release(key string) error {
+	_, err := is.conn.Del(is.key + key).Result()
+	if err != nil {
+		return fmt.Errorf("while deleting from redis: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	redis "github.com/go-redis/redis/v7"
+
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+const (
+	// dailyUsageTTL and monthlyUsageTTL keep past counters around for billing, in seconds.
+	dailyUsageTTL   = 40 * 24 * 60 * 60
+	monthlyUsageTTL = 400 * 24 * 60 * 60
+)
+
+// consumeScript counts a request in the daily and monthly counters of every subject unless one of
+// them reached its bound, KEYS holds the counters and ARGV the bounds of each subject after the
+// TTLs of the counters. It returns whether the request was counted along with the counters.
+var consumeScript = redis.NewScript(`
+local usages = {}
+local allowed = 1
+for i = 1, #KEYS / 2 do
+	local daily = tonumber(redis.call('GET', KEYS[i * 2 - 1]) or '0')
+	local monthly = tonumber(redis.call('GET', KEYS[i * 2]) or '0')
+	local daily_limit = tonumber(ARGV[i * 2 + 1])
+	local monthly_limit = tonumber(ARGV[i * 2 + 2])
+	if (daily_limit > 0 and daily >= daily_limit) or (monthly_limit > 0 and monthly >= monthly_limit) then
+		allowed = 0
+	end
+	usages[i] = {daily, monthly}
+end
+if allowed == 1 then
+	for i = 1, #KEYS / 2 do
+		usages[i][1] = redis.call('INCR', KEYS[i * 2 - 1])
+		redis.call('EXPIRE', KEYS[i * 2 - 1], ARGV[1])
+		usages[i][2] = redis.call('INCR', KEYS[i * 2])
+		redis.call('EXPIRE', KEYS[i * 2], ARGV[2])
+	end
+end
+return {allowed, usages}
+`)
+
+func (reg Registry) quotas() hashStore {
+	return reg.store("quotas")
+}
+
+// WriteQuota stores the quota and notifies running gateways, a quota without bounds is removed.
+func (reg Registry) WriteQuota(quota service.Quota) error {
+	err := quota.Validate()
+	if err != nil {
+		return err
+	}
+
+	return reg.quotas().write(quota.Subject(), quota, quota.IsActive())
+}
+
+func (reg Registry) GetQuotas() ([]service.Quota, error) {
+	quotas := []service.Quota{}
+	err := reg.quotas().each(func(b []byte) error {
+		var quota service.Quota
+
+		err := json.Unmarshal(b, &quota)
+		quotas = append(quotas, quota)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return quotas, nil
+}
+
+func (reg Registry) WatchQuotas() (<-chan service.Quota, error) {
+	rc := make(chan service.Quota)
+	reg.quotas().watch(func(b []byte) error {
+		var quota service.Quota
+
+		err := json.Unmarshal(b, &quota)
+		if err == nil {
+			rc <- quota
+		}
+		return err
+	})
+
+	return rc, nil
+}
+
+// UsageMeter is a service.UsageMeter shared by every gateway using the same redis, counters of
+// past days and months are kept for billing.
+type UsageMeter struct {
+	key  string
+	conn *Connection
+}
+
+func NewUsageMeter(key string, conn *Connection) *UsageMeter {
+	return &UsageMeter{fmt.Sprintf("%s:usage:", key), conn}
+}
+
+func (um UsageMeter) keys(subject string, day string, month string) []string {
+	return []string{um.key + subject + ":" + day, um.key + subject + ":" + month}
+}
+
+func (um UsageMeter) Consume(quotas []service.Quota, day string, month string) ([]service.Usage, bool, error) {
+	keys := make([]string, 0, len(quotas)*2)
+	args := []interface{}{dailyUsageTTL, monthlyUsageTTL}
+	for _, quota := range quotas {
+		keys = append(keys, um.keys(quota.Subject(), day, month)...)
+		args = append(args, quota.Daily, quota.Monthly)
+	}
+
+	res, err := consumeScript.Run(um.conn, keys, args...).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("while counting usage in redis: %v", err)
+	}
+
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return nil, false, fmt.Errorf("unexpected usage reply %v", res)
+	}
+
+	counters, ok := vals[1].([]interface{})
+	if !ok || len(counters) != len(quotas) {
+		return nil, false, fmt.Errorf("unexpected usage reply %v", res)
+	}
+
+	usages := make([]service.Usage, len(quotas))
+	for i, quota := range quotas {
+		usages[i] = service.Usage{Subject: quota.Subject(), Day: day, Month: month}
+
+		counter, _ := counters[i].([]interface{})
+		if len(counter) != 2 {
+			return nil, false, fmt.Errorf("unexpected usage reply %v", res)
+		}
+
+		usages[i].Daily, _ = counter[0].(int64)
+		usages[i].Monthly, _ = counter[1].(int64)
+	}
+
+	return usages, vals[0] == int64(1), nil
+}
+
+func (um UsageMeter) Usage(subject string, day string, month string) (service.Usage, error) {
+	usage := service.Usage{Subject: subject, Day: day, Month: month}
+
+	res, err := um.conn.MGet(um.keys(subject, day, month)...).Result()
+	if err != nil {
+		return usage, fmt.Errorf("while reading from redis: %v", err)
+	}
+
+	if val, ok := res[0].(string); ok {
+		usage.Daily, _ = strconv.ParseInt(val, 10, 64)
+	}
+
+	if val, ok := res[1].(string); ok {
+		usage.Monthly, _ = strconv.ParseInt(val, 10, 64)
+	}
+
+	return usage, nil
+}
+
+func (um UsageMeter) ResetUsage(subject string, day string, month string) error {
+	_, err := um.conn.Del(um.keys(subject, day, month)...).Result()
+	if err != nil {
+		return fmt.Errorf("while deleting from redis: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v7"
+
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// rateLimitScript checks every limit against the current time of redis before counting the
+// request against any of them, ARGV holds the algorithm, limit, window in milliseconds and burst
+// of each key. Sliding windows reply whether they admit the request along with the counts of the
+// previous and current windows and the milliseconds spent in the current one, token buckets along
+// with the tokens remaining.
+var rateLimitScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local states = {}
+local allowed = true
+for i, key in ipairs(KEYS) do
+	local state = {
+		algorithm = ARGV[(i - 1) * 4 + 1],
+		limit = tonumber(ARGV[(i - 1) * 4 + 2]),
+		window = tonumber(ARGV[(i - 1) * 4 + 3]),
+		burst = tonumber(ARGV[(i - 1) * 4 + 4]),
+	}
+	if state.algorithm == 'token_bucket' then
+		state.rate = state.limit / state.window
+		local saved = redis.call('HMGET', key, 'tokens', 'updated')
+		local tokens = tonumber(saved[1]) or state.burst
+		local updated = tonumber(saved[2]) or now
+		state.tokens = math.min(state.burst, tokens + math.max(0, now - updated) * state.rate)
+		state.admitted = state.tokens >= 1
+	else
+		local index = math.floor(now / state.window)
+		state.elapsed = now % state.window
+		state.current_key = key .. ':' .. string.format('%d', index)
+		state.previous = tonumber(redis.call('GET', key .. ':' .. string.format('%d', index - 1)) or '0')
+		state.current = tonumber(redis.call('GET', state.current_key) or '0')
+		state.admitted = state.previous * (1 - state.elapsed / state.window) + state.current + 1 <= state.limit
+	end
+	allowed = allowed and state.admitted
+	states[i] = state
+end
+local res = {}
+for i, key in ipairs(KEYS) do
+	local state = states[i]
+	local admitted = 0
+	if state.admitted then
+		admitted = 1
+	end
+	if state.algorithm == 'token_bucket' then
+		if allowed then
+			state.tokens = state.tokens - 1
+		end
+		redis.call('HMSET', key, 'tokens', tostring(state.tokens), 'updated', string.format('%d', now))
+		redis.call('PEXPIRE', key, math.ceil((state.burst - state.tokens) / state.rate) + 1000)
+		res[i] = {admitted, tostring(state.tokens)}
+	else
+		if allowed then
+			state.current = redis.call('INCR', state.current_key)
+			redis.call('PEXPIRE', state.current_key, state.window * 2)
+		end
+		res[i] = {admitted, state.previous, state.current, state.elapsed}
+	end
+end
+return res
+`)
+
+// RateLimiter is a service.RateLimiter shared by every gateway using the same redis, requests
+// are counted against the clock of redis.
+type RateLimiter struct {
+	key  string
+	conn *Connection
+}
+
+func NewRateLimiter(key string, conn *Connection) *RateLimiter {
+	return &RateLimiter{fmt.Sprintf("%s:ratelimit:", key), conn}
+}
+
+func (rl RateLimiter) Allow(keys []string, limits []service.RateLimit) ([]service.RateLimitResult, error) {
+	if len(keys) != len(limits) {
+		return nil, errors.New("rate limits need a key each")
+	}
+
+	redisKeys := make([]string, len(keys))
+	args := make([]interface{}, 0, len(limits)*4)
+	for i, limit := range limits {
+		redisKeys[i] = rl.key + keys[i]
+		args = append(args, limit.Algorithm, limit.Limit, int64(limit.Window)*1000, limit.Burst)
+	}
+
+	reply, err := rateLimitScript.Run(rl.conn, redisKeys, args...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("while counting request in redis: %v", err)
+	}
+
+	replies, ok := reply.([]interface{})
+	if !ok || len(replies) != len(limits) {
+		return nil, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+
+	res := make([]service.RateLimitResult, len(limits))
+	for i, limit := range limits {
+		vals, _ := replies[i].([]interface{})
+
+		if limit.Algorithm == service.RateLimitTokenBucket {
+			if len(vals) != 2 {
+				return nil, fmt.Errorf("unexpected token bucket reply %v", replies[i])
+			}
+
+			tokens, _ := strconv.ParseFloat(fmt.Sprint(vals[1]), 64)
+			res[i] = service.NewTokenBucketResult(limit, vals[0] == int64(1), tokens)
+			continue
+		}
+
+		if len(vals) != 4 {
+			return nil, fmt.Errorf("unexpected sliding window reply %v", replies[i])
+		}
+
+		counts := make([]int64, len(vals))
+		for j, val := range vals {
+			counts[j], _ = val.(int64)
+		}
+
+		res[i] = service.NewSlidingWindowResult(limit, counts[0] == 1, float64(counts[1]), float64(counts[2]),
+			time.Duration(counts[3])*time.Millisecond)
+	}
+
+	return res, nil
+}
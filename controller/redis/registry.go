@@ -62,6 +62,21 @@ func (reg Registry) Publish(cfg service.Config) error {
 	return reg.PublishRaw(b)
 }
 
+// Remove deletes the service and notifies running gateways, which stop routing to it.
+func (reg Registry) Remove(key string) error {
+	_, err := reg.conn.HDel(reg.key, key).Result()
+	if err != nil {
+		return fmt.Errorf("while writing to redis: %v", err)
+	}
+
+	_, err = reg.conn.Publish(fmt.Sprintf("%s:removed", reg.key), key).Result()
+	if err != nil {
+		return fmt.Errorf("while publishing to redis: %v", err)
+	}
+
+	return nil
+}
+
 func (reg Registry) GetByKeyRaw(key string) ([]byte, error) {
 	res, err := reg.conn.HGet(reg.key, key).Result()
 	if err != nil {
@@ -174,6 +189,20 @@ func (reg Registry) Watch() (<-chan service.Config, error) {
 	return rc, nil
 }
 
+func (reg Registry) WatchRemovals() (<-chan string, error) {
+	rc := make(chan string)
+	sub := reg.conn.Subscribe(fmt.Sprintf("%s:removed", reg.key))
+	ch := sub.Channel()
+
+	go func(ch <-chan *redis.Message, cch chan<- string) {
+		for v := range ch {
+			cch <- v.Payload
+		}
+	}(ch, rc)
+
+	return rc, nil
+}
+
 func (reg Registry) GetRedisByID(id models.CompositeID) (models.Composite, error) {
 	var composite models.Composite
 
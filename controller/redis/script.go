@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"encoding/json"
+
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+func (reg Registry) scripts() hashStore {
+	return reg.store("scripts")
+}
+
+// WriteScript stores the script and notifies running gateways, a script without source is removed.
+func (reg Registry) WriteScript(script service.Script) error {
+	err := script.Validate()
+	if err != nil {
+		return err
+	}
+
+	return reg.scripts().write(script.Name, script, script.IsActive())
+}
+
+func (reg Registry) GetScripts() ([]service.Script, error) {
+	scripts := []service.Script{}
+	err := reg.scripts().each(func(b []byte) error {
+		var script service.Script
+
+		err := json.Unmarshal(b, &script)
+		scripts = append(scripts, script)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scripts, nil
+}
+
+func (reg Registry) WatchScripts() (<-chan service.Script, error) {
+	rc := make(chan service.Script)
+	reg.scripts().watch(func(b []byte) error {
+		var script service.Script
+
+		err := json.Unmarshal(b, &script)
+		if err == nil {
+			rc <- script
+		}
+		return err
+	})
+
+	return rc, nil
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+
+	redis "github.com/go-redis/redis/v7"
+
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
+)
+
+// hashStore keeps records of one kind in a redis hash, every write is published on the channel of
+// the hash so that running gateways apply it.
+type hashStore struct {
+	key  string
+	conn *Connection
+}
+
+func (reg Registry) store(kind string) hashStore {
+	return hashStore{fmt.Sprintf("%s:%s", reg.key, kind), reg.conn}
+}
+
+func (s hashStore) channel() string {
+	return fmt.Sprintf("%s:channel", s.key)
+}
+
+// write stores the record under the field, or removes the field when the record is inactive, then
+// publishes the record.
+func (s hashStore) write(field string, record interface{}, active bool) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("while marshaling json: %v", err)
+	}
+
+	if active {
+		_, err = s.conn.HSet(s.key, field, b).Result()
+	} else {
+		_, err = s.conn.HDel(s.key, field).Result()
+	}
+
+	if err != nil {
+		return fmt.Errorf("while writing to redis: %v", err)
+	}
+
+	_, err = s.conn.Publish(s.channel(), b).Result()
+	if err != nil {
+		return fmt.Errorf("while publishing to redis: %v", err)
+	}
+
+	return nil
+}
+
+// each hands the records of the hash to decode, it stops at the first one which can't be decoded.
+func (s hashStore) each(decode func([]byte) error) error {
+	res, err := s.conn.HGetAll(s.key).Result()
+	if err != nil {
+		return fmt.Errorf("while reading from redis: %v", err)
+	}
+
+	for _, each := range res {
+		err := decode([]byte(each))
+		if err != nil {
+			return fmt.Errorf("while unmarshalling json: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// watch hands the published records to decode, those which can't be decoded are skipped.
+func (s hashStore) watch(decode func([]byte) error) {
+	sub := s.conn.Subscribe(s.channel())
+
+	go func(ch <-chan *redis.Message) {
+		for v := range ch {
+			err := decode([]byte(v.Payload))
+			if err != nil {
+				logger.Err(serror.NewFromErrorc(err, "while unmarshaling json"))
+			}
+		}
+	}(sub.Channel())
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"encoding/json"
+
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+func (reg Registry) traffic() hashStore {
+	return reg.store("traffic")
+}
+
+// WriteTraffic stores the policy and notifies running gateways, a policy without canary is removed.
+func (reg Registry) WriteTraffic(policy service.TrafficPolicy) error {
+	err := policy.Validate()
+	if err != nil {
+		return err
+	}
+
+	return reg.traffic().write(policy.Stable, policy, policy.IsActive())
+}
+
+func (reg Registry) GetTraffic() ([]service.TrafficPolicy, error) {
+	policies := []service.TrafficPolicy{}
+	err := reg.traffic().each(func(b []byte) error {
+		var policy service.TrafficPolicy
+
+		err := json.Unmarshal(b, &policy)
+		policies = append(policies, policy)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+func (reg Registry) WatchTraffic() (<-chan service.TrafficPolicy, error) {
+	rc := make(chan service.TrafficPolicy)
+	reg.traffic().watch(func(b []byte) error {
+		var policy service.TrafficPolicy
+
+		err := json.Unmarshal(b, &policy)
+		if err == nil {
+			rc <- policy
+		}
+		return err
+	})
+
+	return rc, nil
+}
@@ -61,17 +61,19 @@ func (reg Registry) GetConnection(key string) (*grpc.ClientConn, error) {
 		return nil, fmt.Errorf("while fetching controller from registry: %v", err)
 	}
 
-	connURL := reg.resolver.GenerateURL(cfg.Host, helper.IntToString(cfg.Port))
+	connURL := cfg.DialTarget(reg.resolver)
 	logger.Infof("try dialing to service %s(%s) via gRPC", key, connURL)
 
 	conn, err := grpc.Dial(
 		connURL,
-		grpc.WithInsecure(),
-		grpc.WithBalancerName(roundrobin.Name),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(150*1024*1024),
-		),
-		grpc.WithUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor()),
+		append([]grpc.DialOption{
+			grpc.WithInsecure(),
+			grpc.WithBalancerName(roundrobin.Name),
+			grpc.WithDefaultCallOptions(
+				grpc.MaxCallRecvMsgSize(150 * 1024 * 1024),
+			),
+			grpc.WithUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor()),
+		}, cfg.DialOptions()...)...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("while dialing server: %v", err)
@@ -7,30 +7,36 @@ import (
 type ServerConfig struct {
 	Host      string
 	Port      int
+	Socket    string
 	Key       string
 	Name      string
 	Namespace string
 	TypeConn  string
+	Hosts     []string
 }
 
 func NewServer(cfg ServerConfig, reg *Registry) (*service.Server, error) {
 	return service.NewServer(service.Config{
-		Host:      cfg.Host,
-		Port:      cfg.Port,
-		Key:       cfg.Key,
-		Name:      cfg.Name,
-		Namespace: cfg.Namespace,
-		TypeConn:  cfg.TypeConn,
+		Host:         cfg.Host,
+		Port:         cfg.Port,
+		Socket:       cfg.Socket,
+		Key:          cfg.Key,
+		Name:         cfg.Name,
+		Namespace:    cfg.Namespace,
+		TypeConn:     cfg.TypeConn,
+		GatewayHosts: cfg.Hosts,
 	}, reg.writer)
 }
 
 func NewServerHttp(cfg ServerConfig, reg *Registry) (*service.Server, error) {
 	return service.NewServerHttp(service.Config{
-		Host:      cfg.Host,
-		Port:      cfg.Port,
-		Key:       cfg.Key,
-		Name:      cfg.Name,
-		Namespace: cfg.Namespace,
-		TypeConn:  cfg.TypeConn,
+		Host:         cfg.Host,
+		Port:         cfg.Port,
+		Socket:       cfg.Socket,
+		Key:          cfg.Key,
+		Name:         cfg.Name,
+		Namespace:    cfg.Namespace,
+		TypeConn:     cfg.TypeConn,
+		GatewayHosts: cfg.Hosts,
 	}, reg.writer)
 }
@@ -17,10 +17,14 @@ require (
 	github.com/golang/protobuf v1.5.2
 	github.com/joho/godotenv v1.3.0
 	github.com/rivo/uniseg v0.2.0
+	github.com/yuin/gopher-lua v0.0.0-20210529063254-f4c35e4016d9
+	go.elastic.co/apm v1.5.0
 	go.elastic.co/apm/module/apmchi v1.5.0
 	go.elastic.co/apm/module/apmgrpc v1.5.0
+	go.elastic.co/apm/module/apmhttp v1.5.0
 	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
 	google.golang.org/grpc v1.27.1
+	google.golang.org/protobuf v1.26.0
 )
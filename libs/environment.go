@@ -24,6 +24,7 @@ const (
 	AppVersion      = "APP_VERSION"
 	AppHost         = "APP_HOST"
 	AppPort         = "APP_PORT"
+	AppGrpcPort     = "APP_GRPC_PORT"
 	AppEndpoint     = "APP_ENDPOINT"
 	AppOpenEndpoint = "APP_OPEN_ENDPOINT"
 	AppBasepoint    = "APP_BASEPOINT"
@@ -33,6 +34,23 @@ const (
 	AppNamespace    = "APP_NAMESPACE"
 	AppCluster      = "APP_CLUSTER"
 
+	AppIdentitySecret    = "APP_IDENTITY_SECRET"
+	AppHandshakeInterval = "APP_HANDSHAKE_INTERVAL"
+	AppDrainTimeout      = "APP_DRAIN_TIMEOUT"
+	AppMirrorTimeout     = "APP_MIRROR_TIMEOUT"
+	AppMirrorConcurrency = "APP_MIRROR_CONCURRENCY"
+	AppScriptTimeout     = "APP_SCRIPT_TIMEOUT"
+	AppScriptMaxBody     = "APP_SCRIPT_MAX_BODY"
+	AppGrpcWebMaxBody    = "APP_GRPC_WEB_MAX_BODY"
+	AppAggregateTimeout  = "APP_AGGREGATE_TIMEOUT"
+	AppCacheBackend      = "APP_CACHE_BACKEND"
+	AppCacheSize         = "APP_CACHE_SIZE"
+	AppAdminToken        = "APP_ADMIN_TOKEN"
+	AppIdempotencyTTL    = "APP_IDEMPOTENCY_TTL"
+	AppTrustedProxies    = "APP_TRUSTED_PROXIES"
+
+	AppIdempotencyMaxBody = "APP_IDEMPOTENCY_MAX_BODY"
+
 	DBEngine       = "DB_ENGINE"
 	DBHost         = "DB_HOST"
 	DBPort         = "DB_PORT"
@@ -6,6 +6,8 @@ import (
 	"github.com/uzzeet/uzzeet-gateway/controller"
 	"github.com/uzzeet/uzzeet-gateway/libs"
 	"github.com/uzzeet/uzzeet-gateway/service/handler"
+	"google.golang.org/grpc"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -29,6 +31,7 @@ import (
 
 var (
 	httpServer         http.Server
+	grpcServer         *grpc.Server
 	redisConn          *redisreg.Connection
 	authService        auth.Service
 	strictAuthService  auth.Service
@@ -87,16 +90,39 @@ func init() {
 	mux.Use(cors.New(cors.Options{
 		AllowedOrigins: tmpWhitelistArray,
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Accept-Encoding", "Cookie", "Origin", "X-Api-Key"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Accept-Encoding", "Cookie", "Origin", "X-Api-Key",
+			"X-Grpc-Web", "X-User-Agent", "Accept-Version", "Grpc-Timeout", "X-Gateway-Key", "X-Gateway-Timestamp", "X-Gateway-Signature", "X-Gateway-Preview",
+			"X-Gateway-Admin-Token", "Cache-Control", "Idempotency-Key"},
+		ExposedHeaders: []string{"Grpc-Status", "Grpc-Message", "X-Cache", "Age",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+			"X-Quota-Daily-Limit", "X-Quota-Daily-Remaining", "X-Quota-Monthly-Limit", "X-Quota-Monthly-Remaining",
+			"Idempotent-Replayed"},
 	}).Handler)
 
 	fwd = handler.NewChiForwarder(authService, strictAuthService, privateAuthService, mux.Route(helper.Env(libs.AppEndpoint, "/"), nil))
+	fwd.(service.RateLimited).UseRateLimiter(redisreg.NewRateLimiter(controller.DefaultRegistryKey, redisConn))
+	fwd.(service.UsageMetered).UseUsageMeter(redisreg.NewUsageMeter(controller.DefaultRegistryKey, redisConn))
+	fwd.(service.Idempotent).UseIdempotencyStore(redisreg.NewIdempotencyStore(controller.DefaultRegistryKey, redisConn))
+	if helper.Env(libs.AppCacheBackend, "memory") == "redis" {
+		fwd.(service.Cacher).UseCache(redisreg.NewResponseCache(controller.DefaultRegistryKey, redisConn))
+	}
+
 	httpServer = http.Server{
 		Addr:         fmt.Sprintf(":%s", helper.Env(libs.AppPort, "9000")),
 		ReadTimeout:  60 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		Handler:      mux,
 	}
+
+	if helper.Env(libs.AppGrpcPort, "") != "" {
+		var err error
+
+		grpcServer, err = handler.NewGrpcIngress(fwd)
+		if err != nil {
+			logger.Err(err)
+			os.Exit(1)
+		}
+	}
 }
 
 func main() {
@@ -119,6 +145,24 @@ func main() {
 		}
 	}()
 
+	if grpcServer != nil {
+		go func() {
+			addr := fmt.Sprintf(":%s", helper.Env(libs.AppGrpcPort, ""))
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				logger.Err(err)
+				os.Exit(1)
+			}
+
+			logger.Infof("gRPC server is running and listening on %s", addr)
+			err = grpcServer.Serve(listener)
+			if err != nil {
+				logger.Err(err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	go func() {
 		for {
 			select {
@@ -130,6 +174,11 @@ func main() {
 					logger.Err(serror.NewFromErrorc(err, "while shutting down http server"))
 				}
 
+				if grpcServer != nil {
+					logger.Info("shutting down grpc server")
+					grpcServer.GracefulStop()
+				}
+
 				logger.Info("closing redis connection")
 				err = redisConn.Close()
 				if err != nil {
@@ -7,6 +7,10 @@ const (
 	ContentTypeHeaderKey   = "content-type"
 	AuthorizationHeaderKey = "authorization"
 	UserAgentHeaderKey     = "user-agent"
+	AcceptVersionHeaderKey = "accept-version"
+	PreviewHeaderKey       = "x-gateway-preview"
+	AdminTokenHeaderKey    = "x-gateway-admin-token"
+	IdempotencyHeaderKey   = "idempotency-key"
 
 	BvContentTypeHeaderKey     = "bv-content-type"
 	BvRealIPTypeHeaderKey      = "bv-real-ip"
@@ -18,5 +22,7 @@ const (
 	ClientInfoContextValueKey        = "client-info"
 	ServiceContextValueKey           = "service"
 	PathContextValueKey              = "path"
+	RouteContextValueKey             = "route"
 	AuthorizationInfoContextValueKey = "x-authorization-info"
+	AuthorizationSignatureValueKey   = "x-authorization-signature"
 )
@@ -1,5 +1,9 @@
 package models
 
+import (
+	"net/url"
+)
+
 const (
 	BodyTypeJSON = "application/json"
 	BodyTypeXML  = "application/xml"
@@ -27,7 +31,7 @@ type RequestContext struct {
 	method     string
 	body       []byte
 	params     map[string]string
-	query      map[string]string
+	query      url.Values
 	header     map[string]string
 	authInfo   AuthorizationInfo
 	clientInfo ClientInfo
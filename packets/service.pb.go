@@ -30,6 +30,9 @@ type Ack struct {
 	Server               string                      `protobuf:"bytes,2,opt,name=Server,proto3" json:"Server,omitempty"`
 	Checksum             string                      `protobuf:"bytes,3,opt,name=Checksum,proto3" json:"Checksum,omitempty"`
 	ProtectedRoutes      map[string]*ProtectedRoutes `protobuf:"bytes,4,rep,name=ProtectedRoutes,proto3" json:"ProtectedRoutes,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Version              int32                       `protobuf:"varint,5,opt,name=Version,proto3" json:"Version,omitempty"`
+	Capabilities         []string                    `protobuf:"bytes,6,rep,name=Capabilities,proto3" json:"Capabilities,omitempty"`
+	Routes               []*RouteManifest            `protobuf:"bytes,7,rep,name=Routes,proto3" json:"Routes,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}                    `json:"-"`
 	XXX_unrecognized     []byte                      `json:"-"`
 	XXX_sizecache        int32                       `json:"-"`
@@ -88,8 +91,31 @@ func (m *Ack) GetProtectedRoutes() map[string]*ProtectedRoutes {
 	return nil
 }
 
+func (m *Ack) GetVersion() int32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Ack) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+func (m *Ack) GetRoutes() []*RouteManifest {
+	if m != nil {
+		return m.Routes
+	}
+	return nil
+}
+
 type AckRequest struct {
 	From                 string   `protobuf:"bytes,2,opt,name=From,proto3" json:"From,omitempty"`
+	Version              int32    `protobuf:"varint,3,opt,name=Version,proto3" json:"Version,omitempty"`
+	Capabilities         []string `protobuf:"bytes,4,rep,name=Capabilities,proto3" json:"Capabilities,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -127,6 +153,20 @@ func (m *AckRequest) GetFrom() string {
 	return ""
 }
 
+func (m *AckRequest) GetVersion() int32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *AckRequest) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
 type ProtectedRoute struct {
 	IsStrict             bool     `protobuf:"varint,1,opt,name=IsStrict,proto3" json:"IsStrict,omitempty"`
 	Method               string   `protobuf:"bytes,3,opt,name=Method,proto3" json:"Method,omitempty"`
@@ -229,6 +269,85 @@ func (m *ProtectedRoutes) GetRoutes() []*ProtectedRoute {
 	return nil
 }
 
+type RouteManifest struct {
+	Method               string            `protobuf:"bytes,1,opt,name=Method,proto3" json:"Method,omitempty"`
+	Template             string            `protobuf:"bytes,2,opt,name=Template,proto3" json:"Template,omitempty"`
+	Pattern              string            `protobuf:"bytes,3,opt,name=Pattern,proto3" json:"Pattern,omitempty"`
+	Params               []string          `protobuf:"bytes,4,rep,name=Params,proto3" json:"Params,omitempty"`
+	Auth                 string            `protobuf:"bytes,5,opt,name=Auth,proto3" json:"Auth,omitempty"`
+	Metas                map[string]string `protobuf:"bytes,6,rep,name=Metas,proto3" json:"Metas,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *RouteManifest) Reset()         { *m = RouteManifest{} }
+func (m *RouteManifest) String() string { return proto.CompactTextString(m) }
+func (*RouteManifest) ProtoMessage()    {}
+func (*RouteManifest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_7842d62b85457464, []int{4}
+}
+
+func (m *RouteManifest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RouteManifest.Unmarshal(m, b)
+}
+func (m *RouteManifest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RouteManifest.Marshal(b, m, deterministic)
+}
+func (m *RouteManifest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RouteManifest.Merge(m, src)
+}
+func (m *RouteManifest) XXX_Size() int {
+	return xxx_messageInfo_RouteManifest.Size(m)
+}
+func (m *RouteManifest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RouteManifest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RouteManifest proto.InternalMessageInfo
+
+func (m *RouteManifest) GetMethod() string {
+	if m != nil {
+		return m.Method
+	}
+	return ""
+}
+
+func (m *RouteManifest) GetTemplate() string {
+	if m != nil {
+		return m.Template
+	}
+	return ""
+}
+
+func (m *RouteManifest) GetPattern() string {
+	if m != nil {
+		return m.Pattern
+	}
+	return ""
+}
+
+func (m *RouteManifest) GetParams() []string {
+	if m != nil {
+		return m.Params
+	}
+	return nil
+}
+
+func (m *RouteManifest) GetAuth() string {
+	if m != nil {
+		return m.Auth
+	}
+	return ""
+}
+
+func (m *RouteManifest) GetMetas() map[string]string {
+	if m != nil {
+		return m.Metas
+	}
+	return nil
+}
+
 type Request struct {
 	Path                 string   `protobuf:"bytes,1,opt,name=Path,proto3" json:"Path,omitempty"`
 	Method               string   `protobuf:"bytes,2,opt,name=Method,proto3" json:"Method,omitempty"`
@@ -242,7 +361,7 @@ func (m *Request) Reset()         { *m = Request{} }
 func (m *Request) String() string { return proto.CompactTextString(m) }
 func (*Request) ProtoMessage()    {}
 func (*Request) Descriptor() ([]byte, []int) {
-	return fileDescriptor_7842d62b85457464, []int{4}
+	return fileDescriptor_7842d62b85457464, []int{5}
 }
 
 func (m *Request) XXX_Unmarshal(b []byte) error {
@@ -297,7 +416,7 @@ func (m *Response) Reset()         { *m = Response{} }
 func (m *Response) String() string { return proto.CompactTextString(m) }
 func (*Response) ProtoMessage()    {}
 func (*Response) Descriptor() ([]byte, []int) {
-	return fileDescriptor_7842d62b85457464, []int{5}
+	return fileDescriptor_7842d62b85457464, []int{6}
 }
 
 func (m *Response) XXX_Unmarshal(b []byte) error {
@@ -345,6 +464,8 @@ func init() {
 	proto.RegisterType((*AckRequest)(nil), "packets.AckRequest")
 	proto.RegisterType((*ProtectedRoute)(nil), "packets.ProtectedRoute")
 	proto.RegisterType((*ProtectedRoutes)(nil), "packets.ProtectedRoutes")
+	proto.RegisterType((*RouteManifest)(nil), "packets.RouteManifest")
+	proto.RegisterMapType((map[string]string)(nil), "packets.RouteManifest.MetasEntry")
 	proto.RegisterType((*Request)(nil), "packets.Request")
 	proto.RegisterType((*Response)(nil), "packets.Response")
 }
@@ -352,37 +473,45 @@ func init() {
 func init() { proto.RegisterFile("protocs/service.proto", fileDescriptor_7842d62b85457464) }
 
 var fileDescriptor_7842d62b85457464 = []byte{
-	// 465 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x52, 0xcf, 0x8f, 0xd3, 0x3c,
-	0x10, 0xdd, 0xf4, 0x77, 0xa7, 0xab, 0xef, 0x5b, 0x86, 0x05, 0x42, 0xc5, 0xa1, 0xe4, 0xb4, 0x42,
-	0x22, 0x85, 0x22, 0x21, 0x04, 0xa7, 0xb6, 0x80, 0x58, 0xa1, 0x5d, 0x55, 0xee, 0x0d, 0x71, 0xf1,
-	0xba, 0xc3, 0xa6, 0x4a, 0x1a, 0x07, 0xdb, 0xa9, 0x94, 0x2b, 0x47, 0xfe, 0x6a, 0x14, 0xc7, 0x2d,
-	0x69, 0x59, 0x24, 0x6e, 0xf3, 0xc6, 0xcf, 0xe3, 0xf7, 0x9e, 0x07, 0x1e, 0x64, 0x4a, 0x1a, 0x29,
-	0xf4, 0x58, 0x93, 0xda, 0xae, 0x05, 0x85, 0x16, 0x63, 0x37, 0xe3, 0x22, 0x26, 0xa3, 0x87, 0x8f,
-	0x6f, 0xa5, 0xbc, 0x4d, 0x68, 0x6c, 0xdb, 0x37, 0xf9, 0xb7, 0x31, 0x4f, 0x8b, 0x8a, 0x13, 0xfc,
-	0x68, 0x40, 0x73, 0x2a, 0x62, 0x7c, 0x02, 0xfd, 0x6b, 0xbe, 0x21, 0x9d, 0x71, 0x41, 0xbe, 0x37,
-	0xf2, 0x2e, 0xfa, 0xec, 0x77, 0x03, 0x1f, 0x42, 0x67, 0x49, 0x6a, 0x4b, 0xca, 0x6f, 0xd8, 0x23,
-	0x87, 0x70, 0x08, 0xbd, 0x79, 0x44, 0x22, 0xd6, 0xf9, 0xc6, 0x6f, 0xda, 0x93, 0x3d, 0xc6, 0xcf,
-	0xf0, 0xff, 0x42, 0x49, 0x43, 0xc2, 0xd0, 0x8a, 0xc9, 0xdc, 0x90, 0xf6, 0x5b, 0xa3, 0xe6, 0xc5,
-	0x60, 0xf2, 0x34, 0x74, 0xba, 0xc2, 0xa9, 0x88, 0xc3, 0x23, 0xce, 0x87, 0xd4, 0xa8, 0x82, 0x1d,
-	0xdf, 0x1c, 0x7e, 0x85, 0xf3, 0xbb, 0x88, 0x78, 0x06, 0xcd, 0x98, 0x0a, 0x27, 0xb8, 0x2c, 0x31,
-	0x84, 0xf6, 0x96, 0x27, 0x39, 0x59, 0xa5, 0x83, 0x89, 0xbf, 0x7f, 0xec, 0xe8, 0x3e, 0xab, 0x68,
-	0x6f, 0x1b, 0x6f, 0xbc, 0x60, 0x04, 0x30, 0x15, 0x31, 0xa3, 0xef, 0x39, 0x69, 0x83, 0x08, 0xad,
-	0x8f, 0x4a, 0x6e, 0x9c, 0x55, 0x5b, 0x07, 0x3f, 0x3d, 0xf8, 0xef, 0x70, 0x40, 0xe9, 0xfd, 0x52,
-	0x2f, 0x8d, 0x5a, 0x0b, 0x63, 0xdf, 0xef, 0xb1, 0x3d, 0x2e, 0xf3, 0xba, 0x22, 0x13, 0xc9, 0x95,
-	0x4b, 0xc5, 0x21, 0xf4, 0xa1, 0xbb, 0xe0, 0xc6, 0x90, 0x4a, 0xdd, 0xf4, 0x1d, 0xc4, 0x67, 0xd0,
-	0xbe, 0x22, 0xc3, 0xcb, 0x8c, 0x4a, 0xd9, 0xe7, 0x61, 0xf5, 0x65, 0xe1, 0xee, 0xcb, 0xc2, 0x69,
-	0x5a, 0xb0, 0x8a, 0x12, 0xcc, 0xfe, 0x48, 0x16, 0xc7, 0xd0, 0x71, 0x19, 0x7b, 0x36, 0xe3, 0x47,
-	0x7f, 0xb1, 0xcd, 0x1c, 0x2d, 0xb8, 0x84, 0x6e, 0xcd, 0xef, 0x82, 0x9b, 0xc8, 0x85, 0x68, 0xeb,
-	0x9a, 0x81, 0xc6, 0x81, 0x01, 0x84, 0xd6, 0x4c, 0xae, 0x0a, 0x6b, 0xeb, 0x94, 0xd9, 0x3a, 0xb8,
-	0x86, 0x1e, 0x23, 0x9d, 0xc9, 0x54, 0xd7, 0x17, 0xc5, 0x3b, 0x58, 0x94, 0xb2, 0x6f, 0xb8, 0xc9,
-	0xb5, 0x9d, 0xd7, 0x66, 0x0e, 0xdd, 0x35, 0x6f, 0x92, 0x42, 0x77, 0x59, 0xed, 0x31, 0xbe, 0x80,
-	0xfe, 0x27, 0x9e, 0xae, 0x74, 0xc4, 0x63, 0xc2, 0xfb, 0xf5, 0xbd, 0x71, 0xe2, 0x87, 0xa7, 0xf5,
-	0x66, 0x70, 0x82, 0x2f, 0xa1, 0xf7, 0x7e, 0xad, 0x33, 0x6e, 0x44, 0x84, 0x67, 0xfb, 0xb3, 0x1d,
-	0xfb, 0x5e, 0xad, 0x53, 0x29, 0x0e, 0x4e, 0x26, 0xaf, 0xa1, 0x3d, 0x4f, 0x68, 0xcb, 0xf1, 0x39,
-	0xb4, 0xe6, 0x3c, 0x49, 0xfe, 0xf1, 0xde, 0x6c, 0xf0, 0xa5, 0x1f, 0xbe, 0x73, 0xfd, 0x9b, 0x8e,
-	0xfd, 0xa8, 0x57, 0xbf, 0x02, 0x00, 0x00, 0xff, 0xff, 0xc9, 0x69, 0x42, 0xc8, 0x8b, 0x03, 0x00,
-	0x00,
+	// 608 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0x41, 0x6f, 0xd3, 0x4c,
+	0x10, 0xad, 0xe3, 0xd8, 0x89, 0xa7, 0xfd, 0x3e, 0xca, 0x52, 0x8a, 0xb1, 0x38, 0x04, 0x9f, 0x22,
+	0x24, 0x1c, 0x08, 0x12, 0x54, 0x70, 0x4a, 0x03, 0x88, 0x0a, 0xb5, 0x8a, 0xb6, 0x88, 0x03, 0x42,
+	0x48, 0x5b, 0x67, 0x5a, 0x5b, 0x76, 0x6c, 0xe3, 0x5d, 0x47, 0xca, 0x5f, 0xe0, 0xd7, 0xf2, 0x03,
+	0x38, 0x20, 0xaf, 0xd7, 0xae, 0x9d, 0x16, 0xc4, 0x6d, 0xde, 0xf3, 0xcc, 0xee, 0x9b, 0x99, 0xb7,
+	0x86, 0xfb, 0x59, 0x9e, 0x8a, 0xd4, 0xe7, 0x13, 0x8e, 0xf9, 0x3a, 0xf4, 0xd1, 0x93, 0x98, 0x0c,
+	0x32, 0xe6, 0x47, 0x28, 0xb8, 0xf3, 0xf0, 0x2a, 0x4d, 0xaf, 0x62, 0x9c, 0x48, 0xfa, 0xa2, 0xb8,
+	0x9c, 0xb0, 0x64, 0x53, 0xe5, 0xb8, 0x3f, 0x7b, 0xa0, 0xcf, 0xfc, 0x88, 0x3c, 0x02, 0xeb, 0x8c,
+	0xad, 0x90, 0x67, 0xcc, 0x47, 0x5b, 0x1b, 0x69, 0x63, 0x8b, 0x5e, 0x13, 0xe4, 0x10, 0xcc, 0x73,
+	0xcc, 0xd7, 0x98, 0xdb, 0x3d, 0xf9, 0x49, 0x21, 0xe2, 0xc0, 0x70, 0x1e, 0xa0, 0x1f, 0xf1, 0x62,
+	0x65, 0xeb, 0xf2, 0x4b, 0x83, 0xc9, 0x47, 0xb8, 0xb3, 0xc8, 0x53, 0x81, 0xbe, 0xc0, 0x25, 0x4d,
+	0x0b, 0x81, 0xdc, 0xee, 0x8f, 0xf4, 0xf1, 0xee, 0xf4, 0xb1, 0xa7, 0x74, 0x79, 0x33, 0x3f, 0xf2,
+	0xb6, 0x72, 0xde, 0x25, 0x22, 0xdf, 0xd0, 0xed, 0x4a, 0x62, 0xc3, 0xe0, 0x33, 0xe6, 0x3c, 0x4c,
+	0x13, 0xdb, 0x18, 0x69, 0x63, 0x83, 0xd6, 0x90, 0xb8, 0xb0, 0x37, 0x67, 0x19, 0xbb, 0x08, 0xe3,
+	0x50, 0x84, 0xc8, 0x6d, 0x73, 0xa4, 0x8f, 0x2d, 0xda, 0xe1, 0x88, 0x07, 0xa6, 0x52, 0x30, 0x90,
+	0x0a, 0x0e, 0x1b, 0x05, 0x92, 0x3e, 0x65, 0x49, 0x78, 0x89, 0x5c, 0x50, 0x95, 0xe5, 0x7c, 0x85,
+	0x83, 0xdb, 0x64, 0x91, 0x7d, 0xd0, 0x23, 0xdc, 0xa8, 0xf1, 0x94, 0x21, 0xf1, 0xc0, 0x58, 0xb3,
+	0xb8, 0x40, 0x39, 0x97, 0xdd, 0xa9, 0xdd, 0x1c, 0xbc, 0x55, 0x4f, 0xab, 0xb4, 0xd7, 0xbd, 0x23,
+	0xcd, 0xfd, 0x06, 0x30, 0xf3, 0x23, 0x8a, 0xdf, 0x0b, 0xe4, 0x82, 0x10, 0xe8, 0xbf, 0xcf, 0xd3,
+	0x95, 0x1a, 0xac, 0x8c, 0xdb, 0xdd, 0xea, 0x7f, 0xef, 0xb6, 0x7f, 0xb3, 0x5b, 0xf7, 0x87, 0x06,
+	0xff, 0x77, 0xaf, 0x2f, 0xf7, 0x74, 0xc2, 0xcf, 0x45, 0x1e, 0xfa, 0x42, 0xaa, 0x1f, 0xd2, 0x06,
+	0x97, 0xbb, 0x3d, 0x45, 0x11, 0xa4, 0x4b, 0xb5, 0x41, 0x85, 0x4a, 0x11, 0x0b, 0x26, 0x04, 0xe6,
+	0x89, 0xd2, 0x56, 0x43, 0xf2, 0x04, 0x8c, 0x53, 0x14, 0xac, 0xbc, 0xbd, 0x6c, 0xfa, 0xc0, 0xab,
+	0xec, 0xe5, 0xd5, 0xf6, 0xf2, 0x66, 0xc9, 0x86, 0x56, 0x29, 0xee, 0xf1, 0x0d, 0x17, 0x90, 0x49,
+	0xb3, 0x0d, 0x4d, 0x6e, 0xe3, 0xc1, 0x1f, 0x86, 0x56, 0xaf, 0xc3, 0xfd, 0xa5, 0xc1, 0x7f, 0x9d,
+	0x45, 0xb5, 0x34, 0x6b, 0x1d, 0xcd, 0x0e, 0x0c, 0x3f, 0xe1, 0x2a, 0x8b, 0x99, 0x40, 0x25, 0xba,
+	0xc1, 0xed, 0x7e, 0xf4, 0x6e, 0x3f, 0x87, 0x60, 0x2e, 0x58, 0xce, 0x56, 0xf5, 0x38, 0x15, 0x2a,
+	0x57, 0x33, 0x2b, 0x44, 0x20, 0x1d, 0x67, 0x51, 0x19, 0x93, 0x57, 0x75, 0xef, 0xe6, 0x96, 0x97,
+	0x3b, 0x02, 0x3d, 0x99, 0x53, 0x79, 0xb9, 0xca, 0x77, 0x8e, 0x00, 0xae, 0xc9, 0x5b, 0x9c, 0x74,
+	0xd0, 0x76, 0x92, 0xd5, 0xf6, 0xcb, 0x09, 0x0c, 0x5a, 0x66, 0x59, 0x30, 0x11, 0xa8, 0x3a, 0x19,
+	0xb7, 0x66, 0xd1, 0xeb, 0xcc, 0x82, 0x40, 0xff, 0x38, 0x5d, 0x6e, 0x64, 0xb3, 0x7b, 0x54, 0xc6,
+	0xee, 0x19, 0x0c, 0x29, 0xf2, 0x2c, 0x4d, 0x78, 0xfb, 0x4d, 0x6b, 0x9d, 0x37, 0x5d, 0xf2, 0x82,
+	0x89, 0x82, 0xcb, 0xf3, 0x0c, 0xaa, 0xd0, 0x6d, 0xe7, 0x4d, 0x13, 0x18, 0x9c, 0x57, 0xbf, 0x1c,
+	0xf2, 0x0c, 0xac, 0x0f, 0x2c, 0x59, 0xf2, 0x80, 0x45, 0x48, 0xee, 0xb5, 0x9f, 0xb8, 0x12, 0xef,
+	0xec, 0xb5, 0x49, 0x77, 0x87, 0x3c, 0x87, 0xe1, 0xdb, 0x90, 0x67, 0x4c, 0xf8, 0x01, 0xd9, 0xbf,
+	0x9e, 0xa3, 0xca, 0xbe, 0xdb, 0x62, 0x2a, 0xc5, 0xee, 0xce, 0xf4, 0x25, 0x18, 0xf3, 0x18, 0xd7,
+	0x8c, 0x3c, 0x85, 0xfe, 0x9c, 0xc5, 0xf1, 0x3f, 0xd6, 0x1d, 0xef, 0x7e, 0xb1, 0xbc, 0x37, 0x8a,
+	0xbf, 0x30, 0xa5, 0x4f, 0x5f, 0xfc, 0x1e, 0x00, 0xf8, 0x47, 0xb8, 0x57, 0x36, 0x05, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
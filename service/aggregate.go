@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Aggregate is a gateway route fanning out to several endpoints in parallel, the result of each
+// call is merged into a single envelope under the name of the call. Callers are authorized once
+// with Auth, calls to routes needing a stronger method fail: strict covers protected routes while
+// private routes need private. Calls are rate limited and metered like requests of their own.
+type Aggregate struct {
+	Name   string          `json:"name"`
+	Method string          `json:"method,omitempty"`
+	Path   string          `json:"path"`
+	Auth   string          `json:"auth,omitempty"`
+	Calls  []AggregateCall `json:"calls,omitempty"`
+}
+
+// AggregateCall is a call of an aggregate, Path is a gateway path such as /devices/items?limit=5.
+// The aggregate fails when a Required call fails, other failures leave their result empty.
+type AggregateCall struct {
+	Name     string `json:"name"`
+	Method   string `json:"method,omitempty"`
+	Path     string `json:"path"`
+	Timeout  int    `json:"timeout,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// AggregateReader is implemented by registries storing aggregates, an aggregate without calls
+// removes the one with the same name.
+type AggregateReader interface {
+	GetAggregates() ([]Aggregate, error)
+	WatchAggregates() (<-chan Aggregate, error)
+}
+
+type AggregateWriter interface {
+	WriteAggregate(Aggregate) error
+}
+
+// Aggregator is implemented by forwarders able to serve aggregates.
+type Aggregator interface {
+	Aggregate(Aggregate) error
+}
+
+func (a Aggregate) Validate() error {
+	if a.Name == "" {
+		return errors.New("aggregate needs a name")
+	}
+
+	if !a.IsActive() {
+		return nil
+	}
+
+	if !strings.HasPrefix(a.Path, "/") {
+		return fmt.Errorf("path of aggregate %s must start with /", a.Name)
+	}
+
+	switch a.Auth {
+	case "", "protect", "strict", "private":
+
+	default:
+		return fmt.Errorf("unknown auth %s of aggregate %s", a.Auth, a.Name)
+	}
+
+	names := make(map[string]bool)
+	for _, call := range a.Calls {
+		if call.Name == "" || names[call.Name] {
+			return fmt.Errorf("calls of aggregate %s need distinct names", a.Name)
+		}
+		names[call.Name] = true
+
+		if !strings.HasPrefix(call.Path, "/") {
+			return fmt.Errorf("path of call %s of aggregate %s must start with /", call.Name, a.Name)
+		}
+
+		if call.Timeout < 0 {
+			return fmt.Errorf("timeout of call %s of aggregate %s can't be negative", call.Name, a.Name)
+		}
+	}
+
+	return nil
+}
+
+// IsActive tells whether the aggregate has to be served rather than removed.
+func (a Aggregate) IsActive() bool {
+	return len(a.Calls) > 0
+}
+
+// Route returns the method and path the aggregate is served on.
+func (a Aggregate) Route() string {
+	method := strings.ToUpper(a.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	return fmt.Sprintf("%s %s", method, "/"+strings.Trim(a.Path, "/"))
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CacheScopeUser         = "user"
+	CacheScopeOrganization = "org"
+)
+
+// CachePolicy caches the GET responses of the service at the gateway. Responses carrying a
+// Cache-Control max-age are kept that long, the others for the TTL of the first matching route or
+// else TTL, in seconds. Responses of protected routes are cached per user, or per organization
+// when Scope is org.
+type CachePolicy struct {
+	TTL    int          `json:"ttl,omitempty"`
+	Scope  string       `json:"scope,omitempty"`
+	Routes []CacheRoute `json:"routes,omitempty"`
+}
+
+type CacheRoute struct {
+	Path string `json:"path"`
+	TTL  int    `json:"ttl"`
+}
+
+// ResponseCache stores the responses cached by the gateway. Keys start with the key of the
+// service followed by the path, purging a prefix purges a whole service or part of it.
+type ResponseCache interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Purge(prefix string) (int, error)
+}
+
+type cacheRoute struct {
+	CacheRoute
+	rule *regexp.Regexp
+}
+
+func newCacheRoutes(policy *CachePolicy) ([]cacheRoute, error) {
+	res := []cacheRoute{}
+	if policy == nil {
+		return res, nil
+	}
+
+	switch policy.Scope {
+	case "", CacheScopeUser, CacheScopeOrganization:
+
+	default:
+		return nil, fmt.Errorf("unknown cache scope %s", policy.Scope)
+	}
+
+	for _, each := range policy.Routes {
+		rule, _, err := compileTemplate(each.Path)
+		if err != nil {
+			return nil, fmt.Errorf("while compiling cache route %s: %v", each.Path, err)
+		}
+
+		res = append(res, cacheRoute{each, rule})
+	}
+
+	return res, nil
+}
+
+// CachePolicy returns the cache policy of the service, nil when its responses aren't cached.
+func (c *Composite) CachePolicy() *CachePolicy {
+	return c.cfg.Cache
+}
+
+// CacheTTL is how long a response of the path is cached when the service doesn't tell.
+func (c *Composite) CacheTTL(path string) time.Duration {
+	if c.cfg.Cache == nil {
+		return 0
+	}
+
+	for _, each := range c.cacheRoutes {
+		if each.rule.MatchString(path) {
+			return time.Duration(each.TTL) * time.Second
+		}
+	}
+
+	return time.Duration(c.cfg.Cache.TTL) * time.Second
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryCache is a ResponseCache local to the gateway, once full the expired entries are dropped
+// and then arbitrary ones.
+type MemoryCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]memoryEntry
+}
+
+func NewMemoryCache(size int) *MemoryCache {
+	return &MemoryCache{
+		size:    size,
+		entries: make(map[string]memoryEntry),
+	}
+}
+
+func (mc *MemoryCache) Get(key string) ([]byte, bool, error) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	entry, ok := mc.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(mc.entries, key)
+		return nil, false, nil
+	}
+
+	return entry.value, true, nil
+}
+
+func (mc *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if _, ok := mc.entries[key]; !ok && len(mc.entries) >= mc.size {
+		now := time.Now()
+		for k, entry := range mc.entries {
+			if now.After(entry.expires) {
+				delete(mc.entries, k)
+			}
+		}
+
+		for k := range mc.entries {
+			if len(mc.entries) < mc.size {
+				break
+			}
+
+			delete(mc.entries, k)
+		}
+	}
+
+	mc.entries[key] = memoryEntry{value, time.Now().Add(ttl)}
+	return nil
+}
+
+func (mc *MemoryCache) Purge(prefix string) (int, error) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	count := 0
+	for key := range mc.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(mc.entries, key)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Cacher is implemented by forwarders caching responses, UseCache replaces the cache they use.
+type Cacher interface {
+	UseCache(cache ResponseCache)
+}
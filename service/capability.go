@@ -0,0 +1,86 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// LegacyProtocolVersion is assumed for peers whose handshake doesn't carry a version.
+	LegacyProtocolVersion int32 = 1
+
+	// ProtocolVersion is the gateway <-> service protocol revision spoken by this package.
+	ProtocolVersion int32 = 2
+)
+
+const (
+	CapabilityCompression    = "compression"
+	CapabilitySignedIdentity = "signed-identity"
+	CapabilityHealth         = "health"
+	CapabilityRouteManifest  = "route-manifest"
+)
+
+// gatewayCapabilities are the capabilities the gateway side of this package knows how to use.
+var gatewayCapabilities = []string{
+	CapabilityCompression,
+	CapabilitySignedIdentity,
+	CapabilityHealth,
+	CapabilityRouteManifest,
+}
+
+type Protocol struct {
+	Version      int32
+	Capabilities []string
+}
+
+func negotiateProtocol(version int32, local []string, remote []string) Protocol {
+	if version <= 0 {
+		version = LegacyProtocolVersion
+	}
+
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+
+	capabilities := []string{}
+	for _, each := range local {
+		for _, other := range remote {
+			if strings.EqualFold(each, other) {
+				capabilities = append(capabilities, each)
+				break
+			}
+		}
+	}
+
+	return Protocol{
+		Version:      version,
+		Capabilities: capabilities,
+	}
+}
+
+func (p Protocol) Supports(capability string) bool {
+	for _, each := range p.Capabilities {
+		if strings.EqualFold(each, capability) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p Protocol) IsLegacy() bool {
+	return p.Version <= LegacyProtocolVersion
+}
+
+func signIdentity(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyIdentity(secret string, payload string, signature string) bool {
+	return hmac.Equal([]byte(signIdentity(secret, payload)), []byte(strings.ToLower(signature)))
+}
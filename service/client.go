@@ -2,49 +2,103 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.elastic.co/apm/module/apmgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/encoding/gzip"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/uzzeet/uzzeet-gateway/controller/resolver"
+	"github.com/uzzeet/uzzeet-gateway/libs"
 	"github.com/uzzeet/uzzeet-gateway/libs/helper"
 	"github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
+	"github.com/uzzeet/uzzeet-gateway/models"
 	"github.com/uzzeet/uzzeet-gateway/packets"
 )
 
 type Forwarder interface {
 	Mount(*Composite)
+	Unmount(key string)
 }
 
 type Composite struct {
 	packets.ServiceClient
-	Key             string
-	Endpoint        string
-	Connection      *grpc.ClientConn
-	Url             string
-	ProtectedRoutes map[string][]protectedRoute
+	Key        string
+	Endpoint   string
+	Connection *grpc.ClientConn
+	Url        string
+
+	cfg         Config
+	policy      atomic.Value
+	refresh     sync.Mutex
+	cancel      context.CancelFunc
+	inflight    int64
+	draining    int32
+	transcoder  *transcoder
+	rewrites    []rewrite
+	cacheRoutes []cacheRoute
+	rateLimits  []rateLimit
+}
+
+// routePolicy is everything learned from a handshake, it's swapped as a whole on every refresh.
+type routePolicy struct {
+	protocol        Protocol
+	protectedRoutes map[string][]protectedRoute
+	routes          []RouteInfo
+	hash            string
 }
 
 func NewComposite(resolv resolver.Resolver, cfg Config) (*Composite, error) {
-	connURL := resolv.GenerateURL(cfg.Host, helper.IntToString(cfg.Port))
+	rewrites, err := newRewrites(cfg.Rewrites)
+	if err != nil {
+		return nil, fmt.Errorf("while preparing rewrites of service %s: %v", cfg.Key, err)
+	}
+
+	cacheRoutes, err := newCacheRoutes(cfg.Cache)
+	if err != nil {
+		return nil, fmt.Errorf("while preparing cache of service %s: %v", cfg.Key, err)
+	}
+
+	rateLimits, err := newRateLimits(cfg.RateLimits)
+	if err != nil {
+		return nil, fmt.Errorf("while preparing rate limits of service %s: %v", cfg.Key, err)
+	}
 
-	if cfg.TypeConn == "http" {
-		logger.Infof("connecting http composite %s(%s)", cfg.Key, connURL)
+	c, err := newComposite(resolv, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.rewrites = rewrites
+	c.cacheRoutes = cacheRoutes
+	c.rateLimits = rateLimits
+
+	return c, nil
+}
 
-		return &Composite{
-			Key:             cfg.Key,
-			Endpoint:        cfg.gatewayEndpoint,
-			Connection:      nil,
-			Url:             connURL,
-			ServiceClient:   nil,
-			ProtectedRoutes: nil,
-		}, nil
+func newComposite(resolv resolver.Resolver, cfg Config) (*Composite, error) {
+	connURL := cfg.DialTarget(resolv)
+
+	if cfg.TypeConn == TypeConnHTTP {
+		return newHttpComposite(connURL, cfg)
+	}
+
+	if cfg.TypeConn == TypeConnTranscode {
+		return newTranscodeComposite(connURL, cfg)
 	}
 
 	logger.Infof("connecting gRPC composite %s(%s)", cfg.Key, connURL)
@@ -73,9 +127,11 @@ func NewComposite(resolv resolver.Resolver, cfg Config) (*Composite, error) {
 
 		conn, err = grpc.Dial(
 			connURL,
-			grpc.WithInsecure(),
-			grpc.WithBalancerName(roundrobin.Name),
-			grpc.WithUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor()),
+			append([]grpc.DialOption{
+				grpc.WithInsecure(),
+				grpc.WithBalancerName(roundrobin.Name),
+				grpc.WithUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor()),
+			}, cfg.DialOptions()...)...,
 		)
 		if err != nil {
 			if i < max {
@@ -88,16 +144,9 @@ func NewComposite(resolv resolver.Resolver, cfg Config) (*Composite, error) {
 			return nil, fmt.Errorf("while dialing server: %v", err)
 		}
 
-		host, err := os.Hostname()
-		if err != nil {
-			host = "?"
-		}
-
 		logger.Infof("doing handshake with %s", cfg.Key)
 		sc = packets.NewServiceClient(conn)
-		res, err = sc.Handshake(context.Background(), &packets.AckRequest{
-			From: host,
-		})
+		res, err = handshake(context.Background(), sc)
 		if err != nil {
 			if i < max {
 				logger.Warnf("failed to handshaking with service %s, detail: %v", cfg.Key, err)
@@ -117,7 +166,62 @@ func NewComposite(resolv resolver.Resolver, cfg Config) (*Composite, error) {
 		return nil, errors.New("invalid service checksum")
 	}
 
-	ProtectedRoutes := make(map[string][]protectedRoute)
+	policy, err := newRoutePolicy(res)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("service %s speaks protocol v%d with capabilities %v", cfg.Key, policy.protocol.Version, policy.protocol.Capabilities)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Composite{
+		Key:           cfg.Key,
+		Endpoint:      cfg.gatewayEndpoint,
+		Connection:    conn,
+		Url:           "",
+		ServiceClient: sc,
+		cfg:           cfg,
+		cancel:        cancel,
+	}
+	c.policy.Store(policy)
+
+	// services which negotiated health checks are only mounted once they're serving.
+	healthCtx, healthCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = c.Health(healthCtx)
+	healthCancel()
+	if err != nil {
+		cancel()
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	go c.watchConnection(ctx)
+	if interval := time.Duration(helper.StringToInt(helper.Env(libs.AppHandshakeInterval, "60"), 60)) * time.Second; interval > 0 {
+		go c.watchInterval(ctx, interval)
+	}
+
+	return c, nil
+}
+
+func handshake(ctx context.Context, sc packets.ServiceClient) (*packets.Ack, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "?"
+	}
+
+	return sc.Handshake(ctx, &packets.AckRequest{
+		From:         host,
+		Version:      ProtocolVersion,
+		Capabilities: gatewayCapabilities,
+	})
+}
+
+func newRoutePolicy(res *packets.Ack) (*routePolicy, error) {
+	var err error
+
+	lines := []string{}
+	protectedRoutes := make(map[string][]protectedRoute)
 	for method, prs := range res.ProtectedRoutes {
 		for _, route := range prs.Routes {
 			pattern, err := regexp.Compile(route.Pattern)
@@ -132,32 +236,253 @@ func NewComposite(resolv resolver.Resolver, cfg Config) (*Composite, error) {
 				}
 			}
 
-			ProtectedRoutes[method] = append(ProtectedRoutes[method], protectedRoute{
+			protectedRoutes[method] = append(protectedRoutes[method], protectedRoute{
 				pattern: pattern,
 				method:  route.Method,
 			})
+			lines = append(lines, fmt.Sprintf("protect|%s|%s|%s", method, route.Method, route.Pattern))
 		}
 	}
 
-	return &Composite{
-		Key:             cfg.Key,
-		Endpoint:        cfg.gatewayEndpoint,
-		Connection:      conn,
-		Url:             "",
-		ServiceClient:   sc,
-		ProtectedRoutes: ProtectedRoutes,
+	protocol := negotiateProtocol(res.Version, gatewayCapabilities, res.Capabilities)
+
+	var routes []RouteInfo
+	if protocol.Supports(CapabilityRouteManifest) {
+		routes, err = newRouteInfos(res.Routes)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, route := range res.Routes {
+			metas := []string{}
+			for k, v := range route.Metas {
+				metas = append(metas, fmt.Sprintf("%s=%s", k, v))
+			}
+			sort.Strings(metas)
+
+			lines = append(lines, fmt.Sprintf("route|%s|%s|%s|%s|%s", route.Method, route.Template, route.Pattern, route.Auth, strings.Join(metas, ",")))
+		}
+	}
+
+	sort.Strings(lines)
+	lines = append(lines, fmt.Sprintf("protocol|%d|%s", protocol.Version, strings.Join(protocol.Capabilities, ",")))
+	hash := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+
+	return &routePolicy{
+		protocol:        protocol,
+		protectedRoutes: protectedRoutes,
+		routes:          routes,
+		hash:            hex.EncodeToString(hash[:]),
 	}, nil
 }
 
-func (c Composite) Keys() string {
+func (c *Composite) currentPolicy() *routePolicy {
+	return c.policy.Load().(*routePolicy)
+}
+
+// Refresh re-handshakes with the service, or re-reads the manifest of an HTTP service, and swaps
+// the route policy when it has changed since the last handshake. It reports whether the policy has been replaced.
+func (c *Composite) Refresh(ctx context.Context) (bool, error) {
+	if c.cfg.TypeConn == TypeConnHTTP && c.cfg.Manifest != "" {
+		return c.refreshManifest(ctx)
+	}
+
+	if c.ServiceClient == nil {
+		return false, nil
+	}
+
+	c.refresh.Lock()
+	defer c.refresh.Unlock()
+
+	res, err := handshake(ctx, c.ServiceClient)
+	if err != nil {
+		return false, fmt.Errorf("while handshaking with service %s: %v", c.Key, err)
+	}
+
+	if !c.cfg.Check(res.Checksum) {
+		return false, errors.New("invalid service checksum")
+	}
+
+	policy, err := newRoutePolicy(res)
+	if err != nil {
+		return false, err
+	}
+
+	if policy.hash == c.currentPolicy().hash {
+		return false, nil
+	}
+
+	c.policy.Store(policy)
+	logger.Infof("route policy of service %s has been refreshed (%s)", c.Key, helper.Sub(policy.hash, 0, 12))
+
+	return true, nil
+}
+
+func (c *Composite) doRefresh(ctx context.Context, reason string) {
+	rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := c.Refresh(rctx)
+	if err != nil && ctx.Err() == nil {
+		logger.Err(serror.NewFromErrorc(err, fmt.Sprintf("while refreshing service %s on %s", c.Key, reason)))
+	}
+}
+
+func (c *Composite) watchInterval(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			c.doRefresh(ctx, "interval")
+		}
+	}
+}
+
+func (c *Composite) watchConnection(ctx context.Context) {
+	state := c.Connection.GetState()
+	wasReady := state == connectivity.Ready
+
+	for c.Connection.WaitForStateChange(ctx, state) {
+		state = c.Connection.GetState()
+		if state != connectivity.Ready {
+			continue
+		}
+
+		if wasReady {
+			c.doRefresh(ctx, "reconnect")
+		}
+		wasReady = true
+	}
+}
+
+func (c *Composite) Protocol() Protocol {
+	return c.currentPolicy().protocol
+}
+
+// Track marks the start of a call going through this composite, the returned function must be
+// called once the call is over so that a replaced composite knows when it's safe to close.
+func (c *Composite) Track() func() {
+	atomic.AddInt64(&c.inflight, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&c.inflight, -1)
+		})
+	}
+}
+
+// Acquire tracks a call like Track unless the composite is being drained, callers which resolved
+// it right before it was replaced must then resolve it again.
+func (c *Composite) Acquire() (func(), bool) {
+	release := c.Track()
+	if atomic.LoadInt32(&c.draining) != 0 {
+		release()
+		return nil, false
+	}
+
+	return release, true
+}
+
+func (c *Composite) InFlight() int64 {
+	return atomic.LoadInt64(&c.inflight)
+}
+
+// Drain waits for in-flight calls to finish, or the timeout to expire, and then stops the composite.
+// Calls can't be acquired anymore once the drain has started.
+func (c *Composite) Drain(timeout time.Duration) error {
+	atomic.StoreInt32(&c.draining, 1)
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for c.InFlight() > 0 {
+		if time.Now().After(deadline) {
+			logger.Warnf("drain timeout of service %s expired with %d call(s) still in-flight", c.Key, c.InFlight())
+			break
+		}
+
+		<-ticker.C
+	}
+
+	return c.Stop()
+}
+
+func (c *Composite) Dispatch(ctx context.Context, in *packets.Request, opts ...grpc.CallOption) (*packets.Response, error) {
+	defer c.Track()()
+
+	protocol := c.Protocol()
+	if protocol.Supports(CapabilityCompression) {
+		opts = append(opts, grpc.UseCompressor(gzip.Name))
+	}
+
+	if protocol.Supports(CapabilitySignedIdentity) {
+		if secret := helper.Env(libs.AppIdentitySecret, ""); secret != "" {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			if vals := md.Get(models.AuthorizationInfoContextValueKey); len(vals) > 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx, models.AuthorizationSignatureValueKey, signIdentity(secret, vals[0]))
+			}
+		}
+	}
+
+	return c.ServiceClient.Dispatch(ctx, in, opts...)
+}
+
+// Health checks whether the service is serving, services which didn't negotiate health checks are
+// assumed to be.
+func (c *Composite) Health(ctx context.Context) error {
+	if !c.Protocol().Supports(CapabilityHealth) {
+		return nil
+	}
+
+	res, err := healthpb.NewHealthClient(c.Connection).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("while checking health of service %s: %v", c.Key, err)
+	}
+
+	if res.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("service %s is %s", c.Key, res.Status.String())
+	}
+
+	return nil
+}
+
+func (c *Composite) Keys() string {
 	return c.Key
 }
 
-func (c Composite) Endpoints() string {
+func (c *Composite) Endpoints() string {
 	return c.Endpoint
 }
 
-func (c Composite) Stop() error {
+// Hosts lists the virtual hosts the composite is reachable on, it's reachable on any host when
+// the list is empty.
+func (c *Composite) Hosts() []string {
+	return c.cfg.GatewayHosts
+}
+
+func (c *Composite) Config() Config {
+	return c.cfg
+}
+
+func (c *Composite) Stop() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	if c.Connection == nil {
+		return nil
+	}
+
 	err := c.Connection.Close()
 	if err != nil {
 		return fmt.Errorf("while closing composite connection: %v", err)
@@ -166,8 +491,8 @@ func (c Composite) Stop() error {
 	return nil
 }
 
-func (c Composite) IsNeedProtection(method string, path string) (bool, bool, bool) {
-	if routes, ok := c.ProtectedRoutes[method]; ok {
+func (c *Composite) IsNeedProtection(method string, path string) (bool, bool, bool) {
+	if routes, ok := c.currentPolicy().protectedRoutes[method]; ok {
 		for _, route := range routes {
 			if route.pattern.MatchString(path) {
 				switch route.method {
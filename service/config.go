@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
@@ -15,6 +16,12 @@ var (
 	ErrConfigNotFound = errors.New("controller not found")
 )
 
+const (
+	TypeConnGRPC      = "grpc"
+	TypeConnHTTP      = "http"
+	TypeConnTranscode = "transcode"
+)
+
 type RegistryWriter interface {
 	Publish(Config) error
 	Write(Config) error
@@ -26,6 +33,13 @@ type RegistryReader interface {
 	Watch() (<-chan Config, error)
 }
 
+// RegistryRemover is implemented by registries services may be removed from, WatchRemovals
+// notifies the keys of the removed services.
+type RegistryRemover interface {
+	Remove(key string) error
+	WatchRemovals() (<-chan string, error)
+}
+
 type Registry interface {
 	RegistryWriter
 	RegistryReader
@@ -34,32 +48,136 @@ type Registry interface {
 type Config struct {
 	Host            string
 	Port            int
+	Socket          string
 	Key             string
 	Name            string
 	Namespace       string
 	TypeConn        string
+	Bindings        []Binding
+	Services        []GrpcService
+	Routes          []HttpRoute
+	Manifest        string
+	GatewayHosts    []string
+	Version         string
+	Rewrites        []Rewrite
+	Mirror          *Mirror
+	Preview         string
+	Filters         []FilterConfig
+	Cache           *CachePolicy
+	RateLimits      []RateLimit
 	gatewayEndpoint string
 }
 
+// Binding maps a REST endpoint onto a method of a typed gRPC service, it's used by transcode composites.
+type Binding struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	RPC    string `json:"rpc"`
+	Body   string `json:"body"`
+	Auth   string `json:"auth"`
+}
+
+// GrpcService declares a typed gRPC service which native gRPC clients can reach through the gateway.
+// Auth is applied to every method unless the method is listed in Methods.
+type GrpcService struct {
+	Name    string            `json:"name"`
+	Auth    string            `json:"auth"`
+	Methods map[string]string `json:"methods,omitempty"`
+}
+
+// HttpRoute declares a route of an HTTP service, routes with Auth are protected by the gateway.
+// They're read from the registry entry or from the manifest endpoint of the service.
+type HttpRoute struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Auth   string `json:"auth"`
+}
+
+// Rewrite changes the path of a request before it reaches the service. A rule either replaces
+// the Prefix of the path, an empty Replace strips it, or rewrites the path matching Regex where
+// Replace may refer to the groups as $1.
+type Rewrite struct {
+	Prefix  string `json:"prefix,omitempty"`
+	Regex   string `json:"regex,omitempty"`
+	Replace string `json:"replace"`
+}
+
+// Mirror duplicates a Sample percentage of the requests of a service to the Shadow one, responses
+// of the shadow are discarded. Only requests of Methods are mirrored, the safe GET, HEAD and
+// OPTIONS by default so that the shadow doesn't replay writes.
+type Mirror struct {
+	Shadow  string   `json:"shadow"`
+	Sample  int      `json:"sample"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+// Mirrors tells whether requests of the method are mirrored.
+func (m Mirror) Mirrors(method string) bool {
+	methods := m.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+	}
+
+	for _, each := range methods {
+		if strings.EqualFold(each, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilterConfig attaches a named gateway filter to the service, Options are decoded by the filter.
+type FilterConfig struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
 type jsonConfig struct {
-	Host            string `json:"host"`
-	Port            int    `json:"port"`
-	Key             string `json:"key"`
-	Name            string `json:"name"`
-	Namespace       string `json:"namespace"`
-	TypeConn        string `json:"typeconn"`
-	GatewayEndpoint string `json:"gateway_endpoint"`
+	Host            string         `json:"host"`
+	Port            int            `json:"port"`
+	Socket          string         `json:"socket,omitempty"`
+	Key             string         `json:"key"`
+	Name            string         `json:"name"`
+	Namespace       string         `json:"namespace"`
+	TypeConn        string         `json:"typeconn"`
+	GatewayEndpoint string         `json:"gateway_endpoint"`
+	Bindings        []Binding      `json:"bindings,omitempty"`
+	Services        []GrpcService  `json:"services,omitempty"`
+	Routes          []HttpRoute    `json:"routes,omitempty"`
+	Manifest        string         `json:"manifest,omitempty"`
+	GatewayHosts    []string       `json:"gateway_hosts,omitempty"`
+	Version         string         `json:"version,omitempty"`
+	Rewrites        []Rewrite      `json:"rewrites,omitempty"`
+	Mirror          *Mirror        `json:"mirror,omitempty"`
+	Preview         string         `json:"preview,omitempty"`
+	Filters         []FilterConfig `json:"filters,omitempty"`
+	Cache           *CachePolicy   `json:"cache,omitempty"`
+	RateLimits      []RateLimit    `json:"rate_limits,omitempty"`
 }
 
 func (cfg Config) MarshalJSON() ([]byte, error) {
 	jc := jsonConfig{
 		Host:            cfg.Host,
 		Port:            cfg.Port,
+		Socket:          cfg.Socket,
 		Key:             cfg.Key,
 		Name:            cfg.Name,
 		Namespace:       cfg.Namespace,
 		TypeConn:        cfg.TypeConn,
 		GatewayEndpoint: cfg.gatewayEndpoint,
+		Bindings:        cfg.Bindings,
+		Services:        cfg.Services,
+		Routes:          cfg.Routes,
+		Manifest:        cfg.Manifest,
+		GatewayHosts:    cfg.GatewayHosts,
+		Version:         cfg.Version,
+		Rewrites:        cfg.Rewrites,
+		Mirror:          cfg.Mirror,
+		Preview:         cfg.Preview,
+		Filters:         cfg.Filters,
+		Cache:           cfg.Cache,
+		RateLimits:      cfg.RateLimits,
 	}
 
 	return json.Marshal(jc)
@@ -75,10 +193,23 @@ func (cfg *Config) UnmarshalJSON(v []byte) error {
 
 	cfg.Host = tmp.Host
 	cfg.Port = tmp.Port
+	cfg.Socket = tmp.Socket
 	cfg.Key = tmp.Key
 	cfg.Name = tmp.Name
 	cfg.Namespace = tmp.Namespace
 	cfg.TypeConn = tmp.TypeConn
+	cfg.Bindings = tmp.Bindings
+	cfg.Services = tmp.Services
+	cfg.Routes = tmp.Routes
+	cfg.Manifest = tmp.Manifest
+	cfg.GatewayHosts = tmp.GatewayHosts
+	cfg.Version = tmp.Version
+	cfg.Rewrites = tmp.Rewrites
+	cfg.Mirror = tmp.Mirror
+	cfg.Preview = tmp.Preview
+	cfg.Filters = tmp.Filters
+	cfg.Cache = tmp.Cache
+	cfg.RateLimits = tmp.RateLimits
 	cfg.gatewayEndpoint = tmp.GatewayEndpoint
 
 	return nil
@@ -99,7 +230,7 @@ func (cfg Config) Check(checksum string) bool {
 
 func (cfg Config) checksum() string {
 	s256 := sha256.Sum256([]byte(fmt.Sprintf(
-		"<%s:%d:%s:%s:%s:%s>",
+		"<%s:%d:%s:%s:%s:%s:%s>",
 		cfg.Host,
 		cfg.Port,
 		cfg.Key,
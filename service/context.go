@@ -8,7 +8,9 @@ import (
 	"github.com/uzzeet/uzzeet-gateway/models"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
 
@@ -43,7 +45,7 @@ type requestContext struct {
 	body       []byte
 	params     map[string]string
 	forms      string
-	query      map[string]string
+	query      url.Values
 	header     map[string]string
 	authInfo   models.AuthorizationInfo
 	clientInfo models.ClientInfo
@@ -204,19 +206,136 @@ func (rc requestContext) DefaultPostForm(key string, def string) string {
 }
 
 func (rc requestContext) Query(key string) string {
-	return rc.query[key]
+	return rc.query.Get(key)
 }
 
 func (rc requestContext) DefaultQuery(key string, def string) string {
-	val, ok := rc.query[key]
-	if ok {
-		return val
+	if vals, ok := rc.query[key]; ok && len(vals) > 0 {
+		return vals[0]
 	}
 	return def
 }
 
 func (rc requestContext) Queries() map[string]string {
-	return rc.query
+	res := make(map[string]string)
+	for key, vals := range rc.query {
+		if len(vals) > 0 {
+			res[key] = vals[0]
+		}
+	}
+
+	return res
+}
+
+func (rc requestContext) QueryArray(key string) []string {
+	res := []string{}
+	res = append(res, rc.query[key]...)
+	res = append(res, rc.query[fmt.Sprintf("%s[]", key)]...)
+
+	return res
+}
+
+func (rc requestContext) QueryMap(key string) map[string]string {
+	res := make(map[string]string)
+	for k, vals := range rc.query {
+		if len(vals) == 0 || !strings.HasPrefix(k, fmt.Sprintf("%s[", key)) || !strings.HasSuffix(k, "]") {
+			continue
+		}
+
+		sub := k[len(key)+1 : len(k)-1]
+		if sub == "" || strings.ContainsAny(sub, "[]") {
+			continue
+		}
+
+		res[sub] = vals[0]
+	}
+
+	return res
+}
+
+// QueryBind decodes the queries into the struct v points to. Queries bound to slice or array
+// fields are decoded as arrays, even with a single value, the others keep their first value.
+func (rc requestContext) QueryBind(v interface{}) serror.SError {
+	arrays := arrayFields(v)
+
+	params := []string{}
+	for key, vals := range rc.query {
+		if len(vals) == 0 {
+			continue
+		}
+
+		name := key
+		switch {
+		case strings.HasSuffix(key, "]"):
+			// keys in brackets are decoded by qs as they are.
+
+		case arrays[strings.ToLower(key)]:
+			name = fmt.Sprintf("%s[]", key)
+
+		default:
+			vals = vals[:1]
+		}
+
+		for _, val := range vals {
+			params = append(params, fmt.Sprintf("%s=%s", url.QueryEscape(name), url.QueryEscape(val)))
+		}
+	}
+
+	if len(params) == 0 {
+		return nil
+	}
+
+	res, err := qs.Unmarshal(strings.Join(params, "&"))
+	if err != nil {
+		return serror.NewFromErrorc(err, "Failed to unmarshal query")
+	}
+
+	byt, err := json.Marshal(res)
+	if err != nil {
+		return serror.NewFromErrorc(err, "Failed to marshal json")
+	}
+
+	err = json.Unmarshal(byt, v)
+	if err != nil {
+		return serror.NewFromErrorc(err, "Failed to unmarshal json")
+	}
+
+	return nil
+}
+
+// arrayFields returns the JSON names, in lower case as they're matched case-insensitively, of the
+// slice and array fields of the struct v points to.
+func arrayFields(v interface{}) map[string]bool {
+	res := make(map[string]bool)
+
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return res
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || (field.Type.Kind() != reflect.Slice && field.Type.Kind() != reflect.Array) {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		switch name {
+		case "-":
+			continue
+
+		case "":
+			name = field.Name
+		}
+
+		res[strings.ToLower(name)] = true
+	}
+
+	return res
 }
 
 func (rc requestContext) ContentType() string {
@@ -276,6 +395,21 @@ func (rc requestContext) ClientInfo() models.ClientInfo {
 	return rc.clientInfo
 }
 
+// Preview is the preview environment the request was routed to, calls made on its behalf should
+// carry it along with WithPreview.
+func (rc requestContext) Preview() string {
+	return rc.XHeader(models.PreviewHeaderKey)
+}
+
+// WithPreview makes outgoing calls going through the gateway prefer the composites of the preview.
+func WithPreview(ctx context.Context, preview string) context.Context {
+	if preview == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, models.PreviewHeaderKey, preview)
+}
+
 func (ctx *responseContext) SetHeader(key, value string) {
 	ctx.header[http.CanonicalHeaderKey(key)] = value
 }
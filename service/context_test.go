@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestQueryBind(t *testing.T) {
+	type filter struct {
+		Status []string `json:"status"`
+		Name   string   `json:"name"`
+		IDs    []string
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  filter
+	}{
+		{"single value into a slice", "status=a", filter{Status: []string{"a"}}},
+		{"several values into a slice", "status=a&status=b", filter{Status: []string{"a", "b"}}},
+		{"slice in brackets", "status[]=a", filter{Status: []string{"a"}}},
+		{"field without tag", "ids=1", filter{IDs: []string{"1"}}},
+		{"several values into a string", "name=a&name=b", filter{Name: "a"}},
+		{"no query", "", filter{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("while parsing query: %v", err)
+			}
+
+			got := filter{}
+			errx := requestContext{query: query}.QueryBind(&got)
+			if errx != nil {
+				t.Fatalf("QueryBind() error = %v", errx)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBind(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// Aggregate serves the aggregate, it takes effect for the next requests.
+func (fwd *chiForwarder) Aggregate(aggregate service.Aggregate) error {
+	err := aggregate.Validate()
+	if err != nil {
+		return err
+	}
+
+	fwd.mutex.Lock()
+	fwd.snapshot.Store(fwd.table().withAggregate(aggregate))
+	fwd.mutex.Unlock()
+
+	if aggregate.IsActive() {
+		L.Infof("aggregate %s is served on %s with %d call(s)", aggregate.Name, aggregate.Route(), len(aggregate.Calls))
+	} else {
+		L.Infof("aggregate %s isn't served anymore", aggregate.Name)
+	}
+
+	return nil
+}
+
+// aggregation serves the aggregates, other requests go on to their composite.
+func (fwd chiForwarder) aggregation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := fmt.Sprintf("%s /%s", r.Method, strings.Trim(chi.URLParam(r, "*"), "/"))
+
+		aggregate, ok := fwd.table().aggregates[route]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		fwd.aggregate(w, r, aggregate)
+	})
+}
+
+type aggregateResult struct {
+	status  int
+	message string
+	result  json.RawMessage
+}
+
+func (res aggregateResult) failed() bool {
+	return res.status < 200 || res.status > 299
+}
+
+// aggregate runs the calls in parallel and merges their result into a single envelope.
+func (fwd chiForwarder) aggregate(w http.ResponseWriter, r *http.Request, aggregate service.Aggregate) {
+	if aggregate.Auth != "" {
+		authService, _ := fwd.authServiceOf(aggregate.Auth)
+
+		var ok bool
+		r, ok = fwd.authorize(w, r, authService)
+		if !ok {
+			return
+		}
+	}
+
+	results := make([]aggregateResult, len(aggregate.Calls))
+
+	var wg sync.WaitGroup
+	for i, call := range aggregate.Calls {
+		wg.Add(1)
+		go func(i int, call service.AggregateCall) {
+			defer wg.Done()
+			results[i] = fwd.aggregateCall(r, aggregate, call)
+		}(i, call)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	failures := []string{}
+	merged := make(map[string]json.RawMessage)
+	for i, call := range aggregate.Calls {
+		res := results[i]
+		if res.failed() {
+			L.Warnf("call %s of aggregate %s answered %d: %s", call.Name, aggregate.Name, res.status, res.message)
+			failures = append(failures, call.Name)
+			merged[call.Name] = json.RawMessage("null")
+
+			if call.Required {
+				code = http.StatusBadGateway
+			}
+
+			continue
+		}
+
+		merged[call.Name] = res.result
+	}
+
+	message := ""
+	if len(failures) > 0 {
+		message = fmt.Sprintf("Sebagian layanan gagal: %s", strings.Join(failures, ", "))
+	}
+
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(code)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   code,
+		Error:      message,
+		Svcid:      aggregate.Name,
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     merged,
+	}))
+}
+
+// aggregateCall runs a call like a request of its own carrying the identity of the caller, it goes
+// through the middlewares of its composite except for authorization: the route of the call must not
+// require a stronger auth than the aggregate.
+func (fwd chiForwarder) aggregateCall(r *http.Request, aggregate service.Aggregate, call service.AggregateCall) aggregateResult {
+	u, err := url.Parse(call.Path)
+	if err != nil || !strings.HasPrefix(u.Path, "/") {
+		return aggregateResult{status: http.StatusBadRequest, message: "Jalur tidak valid"}
+	}
+
+	method := strings.ToUpper(call.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	timeout := time.Duration(helper.StringToInt(helper.Env(libs.AppAggregateTimeout, "10"), 10)) * time.Second
+	if call.Timeout > 0 {
+		timeout = time.Duration(call.Timeout) * time.Millisecond
+	}
+
+	ctx, cancel := context.WithTimeout(withRoutePath(r.Context(), u.Path), timeout)
+	defer cancel()
+
+	req := r.Clone(ctx)
+	req.Method = method
+	req.URL.Path = u.Path
+	req.URL.RawPath = u.RawPath
+	req.URL.RawQuery = u.RawQuery
+	req.RequestURI = u.RequestURI()
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	req.Header.Del(models.ContentTypeHeaderKey)
+	req.Header.Del(models.IdempotencyHeaderKey)
+
+	handler := chi.Chain(
+		fwd.serviceIdentification,
+		fwd.routeValidation,
+		fwd.anonymousRateLimit,
+		fwd.grantedAuthorization(aggregate.Auth),
+		fwd.rateLimit,
+		fwd.usageQuota,
+		fwd.trafficSplit,
+		fwd.applyFilters,
+		fwd.responseCache,
+		fwd.trafficMirror,
+	).HandlerFunc(fwd.forward)
+
+	recorder := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+	handler.ServeHTTP(recorder, req)
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return aggregateResult{status: http.StatusGatewayTimeout, message: "Layanan tidak merespons"}
+	}
+
+	return newAggregateResult(recorder)
+}
+
+// grantedAuthorization stands for authorization in the calls of an aggregate, which was authorized
+// with the granted auth method already.
+func (fwd chiForwarder) grantedAuthorization(granted string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
+			path := r.Context().Value(models.PathContextValueKey).(string)
+
+			if required := fwd.authMethodOf(composite, r.Method, path); !satisfiesAuth(granted, required) {
+				fwd.failure(w, r, http.StatusUnauthorized, fmt.Sprintf("Jalur membutuhkan otorisasi %s", required))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// satisfiesAuth tells whether a request authorized with the granted method may reach a route
+// requiring another one, strict tokens satisfy protected routes while private routes need private
+// tokens.
+func satisfiesAuth(granted string, required string) bool {
+	switch required {
+	case "":
+		return true
+
+	case "protect":
+		return granted == "protect" || granted == "strict"
+	}
+
+	return granted == required
+}
+
+// newAggregateResult takes the result out of the models.Response envelope, other JSON bodies are
+// taken as they are and anything else as a string.
+func newAggregateResult(recorder *bufferedResponse) aggregateResult {
+	res := aggregateResult{status: recorder.status}
+	body := bytes.TrimSpace(recorder.body.Bytes())
+
+	var envelope struct {
+		Response *int            `json:"response"`
+		Error    string          `json:"error"`
+		Result   json.RawMessage `json:"result"`
+	}
+
+	switch {
+	case isJSON(recorder.header) && json.Unmarshal(body, &envelope) == nil && envelope.Response != nil:
+		res.message = envelope.Error
+		res.result = envelope.Result
+
+	case isJSON(recorder.header) && json.Valid(body):
+		res.result = body
+
+	default:
+		res.result, _ = json.Marshal(string(body))
+	}
+
+	if len(res.result) == 0 {
+		res.result = json.RawMessage("null")
+	}
+
+	if res.failed() && res.message == "" {
+		res.message = http.StatusText(res.status)
+	}
+
+	return res
+}
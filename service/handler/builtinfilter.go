@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+func init() {
+	RegisterFilter("headers", newHeadersFilter)
+	RegisterFilter("body_limit", newBodyLimitFilter)
+}
+
+type headerRules struct {
+	Set    map[string]string `json:"set"`
+	Add    map[string]string `json:"add"`
+	Remove []string          `json:"remove"`
+}
+
+func (rules headerRules) apply(header http.Header) {
+	for _, key := range rules.Remove {
+		header.Del(key)
+	}
+
+	for key, val := range rules.Set {
+		header.Set(key, val)
+	}
+
+	for key, val := range rules.Add {
+		header.Add(key, val)
+	}
+}
+
+// headersFilter sets, adds or removes headers of the request sent to the service and of the
+// response sent back to the client.
+type headersFilter struct {
+	Request  headerRules `json:"request"`
+	Response headerRules `json:"response"`
+}
+
+func newHeadersFilter(options json.RawMessage) (Filter, error) {
+	f := &headersFilter{}
+	if len(options) > 0 {
+		err := json.Unmarshal(options, f)
+		if err != nil {
+			return nil, fmt.Errorf("while decoding options: %v", err)
+		}
+	}
+
+	reserved := map[string]bool{}
+	for _, key := range identityHeaderKeys {
+		reserved[http.CanonicalHeaderKey(key)] = true
+	}
+
+	for _, rules := range []map[string]string{f.Request.Set, f.Request.Add} {
+		for key := range rules {
+			if reserved[http.CanonicalHeaderKey(key)] {
+				return nil, fmt.Errorf("header %s is reserved", key)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func (f *headersFilter) OnRequest(r *http.Request) (*http.Request, error) {
+	f.Request.apply(r.Header)
+	return r, nil
+}
+
+func (f *headersFilter) OnResponse(r *http.Request, res *FilterResponse) error {
+	f.Response.apply(res.Header)
+	return nil
+}
+
+// bodyLimitFilter rejects requests with a body larger than MaxBytes, the bound is enforced before
+// the request is authorized, see limitBody. Bodies of unknown length are read upfront to be
+// measured.
+type bodyLimitFilter struct {
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+func newBodyLimitFilter(options json.RawMessage) (Filter, error) {
+	f := &bodyLimitFilter{}
+	err := json.Unmarshal(options, f)
+	if err != nil {
+		return nil, fmt.Errorf("while decoding options: %v", err)
+	}
+
+	if f.MaxBytes <= 0 {
+		return nil, errors.New("max_bytes must be positive")
+	}
+
+	return f, nil
+}
+
+func (f *bodyLimitFilter) MaxBodyBytes() int64 {
+	return f.MaxBytes
+}
+
+func (f *bodyLimitFilter) OnRequest(r *http.Request) (*http.Request, error) {
+	if r.ContentLength > f.MaxBytes {
+		return nil, NewFilterError(http.StatusRequestEntityTooLarge, "Permintaan terlalu besar")
+	}
+
+	if r.ContentLength >= 0 || r.Body == nil {
+		return r, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, f.MaxBytes+1))
+	if err != nil {
+		return nil, NewFilterError(http.StatusBadRequest, "Gagal membaca permintaan")
+	}
+
+	if int64(len(body)) > f.MaxBytes {
+		return nil, NewFilterError(http.StatusRequestEntityTooLarge, "Permintaan terlalu besar")
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	return r, nil
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/uzzeet/uzzeet-gateway/controller/auth"
+)
+
+func TestHeadersFilterReserved(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		wantErr bool
+	}{
+		{"no rules", `{}`, false},
+		{"other header", `{"request":{"set":{"X-Tenant":"t1"}}}`, false},
+		{"reserved header set", `{"request":{"set":{"client-info":"{}"}}}`, true},
+		{"reserved header in mixed case", `{"request":{"set":{"Client-Info":"{}"}}}`, true},
+		{"reserved header added in upper case", `{"request":{"add":{"X-AUTHORIZATION-INFO":"{}"}}}`, true},
+		{"reserved header of the response", `{"response":{"set":{"Client-Info":"{}"}}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newHeadersFilter([]byte(tt.options))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newHeadersFilter(%s) error = %v, want error %v", tt.options, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBodyLimitBeforeAuthorization(t *testing.T) {
+	mux := chi.NewMux()
+	// requests without credentials fail authorization.
+	authService := auth.NewService("protect", "secret", nil, false)
+	fwd := NewChiForwarder(authService, authService, authService, mux)
+	fwd.Mount(newTestComposite(t, `"key":"devices","gateway_endpoint":"/devices",
+		"routes":[{"method":"post","path":"/.*","auth":"protect"}],
+		"filters":[{"name":"body_limit","options":{"max_bytes":4}}]`))
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"within the limit", "abcd", false, http.StatusUnauthorized},
+		{"over the limit", "abcde", false, http.StatusRequestEntityTooLarge},
+		{"unknown length within the limit", "abcd", true, http.StatusUnauthorized},
+		{"unknown length over the limit", "abcde", true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/devices/1", strings.NewReader(tt.body))
+			if tt.chunked {
+				r.Body = ioutil.NopCloser(strings.NewReader(tt.body))
+				r.ContentLength = -1
+			}
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("request answered %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
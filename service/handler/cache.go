@@ -0,0 +1,364 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// maxRecordedBody bounds the responses kept by teeRecorder, larger ones are only streamed.
+const maxRecordedBody = 1 << 20
+
+// UseCache replaces the cache of the responses, entries of the previous one are left behind.
+func (fwd *chiForwarder) UseCache(cache service.ResponseCache) {
+	fwd.cache.Store(&cache)
+}
+
+func (fwd chiForwarder) responses() service.ResponseCache {
+	return *fwd.cache.Load().(*service.ResponseCache)
+}
+
+// cachedResponse is the entry stored for a response.
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	Stored time.Time   `json:"stored"`
+}
+
+// responseCache serves the GET and HEAD requests of services with a cache policy from the cache.
+// An entry is stored under the key of the request followed by the values of the headers the
+// response varies on, the names of those headers are stored under the key of the request itself.
+func (fwd chiForwarder) responseCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
+
+		policy := composite.CachePolicy()
+		if policy == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) || isUpgradeRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		directives := cacheDirectives(r.Header)
+		if _, ok := directives["no-store"]; ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scope, ok := cacheScope(r, policy)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		path := r.Context().Value(models.PathContextValueKey).(string)
+		key := cacheKey(composite, path, r.URL.Query(), scope)
+
+		cache := fwd.responses()
+		if _, ok := directives["no-cache"]; !ok {
+			if entry, ok := fwd.cached(cache, key, r); ok {
+				writeCached(w, r, entry)
+				return
+			}
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &teeRecorder{ResponseWriter: w, header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		ttl, ok := cacheTTL(recorder, composite, path, scope)
+		if !ok {
+			return
+		}
+
+		vary := varyNames(recorder.header)
+		entry, err := json.Marshal(cachedResponse{
+			Status: recorder.status,
+			Header: recorder.header,
+			Body:   recorder.body.Bytes(),
+			Stored: time.Now(),
+		})
+		if err != nil {
+			L.Err(serror.NewFromErrorc(err, "while encoding cached response"))
+			return
+		}
+
+		index, _ := json.Marshal(vary)
+		err = cache.Set(key, index, ttl)
+		if err == nil {
+			err = cache.Set(variantKey(key, vary, r.Header), entry, ttl)
+		}
+
+		if err != nil {
+			L.Err(serror.NewFromErrorc(err, "while caching response"))
+		}
+	})
+}
+
+// cached returns the entry matching the request, failures of the cache are taken as misses.
+func (fwd chiForwarder) cached(cache service.ResponseCache, key string, r *http.Request) (cachedResponse, bool) {
+	var (
+		vary  []string
+		entry cachedResponse
+	)
+
+	index, ok, err := cache.Get(key)
+	if err == nil && ok {
+		err = json.Unmarshal(index, &vary)
+	}
+
+	if err == nil && ok {
+		var b []byte
+
+		b, ok, err = cache.Get(variantKey(key, vary, r.Header))
+		if err == nil && ok {
+			err = json.Unmarshal(b, &entry)
+		}
+	}
+
+	if err != nil {
+		L.Err(serror.NewFromErrorc(err, "while reading cached response"))
+		return entry, false
+	}
+
+	return entry, ok
+}
+
+func writeCached(w http.ResponseWriter, r *http.Request, entry cachedResponse) {
+	for key, vals := range entry.Header {
+		w.Header()[key] = vals
+	}
+
+	w.Header().Set("X-Cache", "HIT")
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.Stored).Seconds())))
+	w.Header().Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	w.WriteHeader(entry.Status)
+
+	if r.Method != http.MethodHead {
+		_, err := w.Write(entry.Body)
+		logger(err)
+	}
+}
+
+// cacheScope is the part of the key isolating the responses of protected routes, they're
+// cached per user or per organization. Requests without the identity the scope needs aren't
+// cached.
+func cacheScope(r *http.Request, policy *service.CachePolicy) (string, bool) {
+	authInfo, ok := r.Context().Value(models.AuthorizationInfoContextValueKey).(*models.AuthorizationInfo)
+	if !ok || authInfo == nil {
+		return "", true
+	}
+
+	if policy.Scope == service.CacheScopeOrganization {
+		return "org=" + authInfo.OrganizationId, authInfo.OrganizationId != ""
+	}
+
+	return "user=" + authInfo.UserID, authInfo.UserID != ""
+}
+
+// cacheKey starts with the key of the service and the path sent to it so that entries are purged
+// by prefix.
+func cacheKey(composite *service.Composite, path string, query url.Values, scope string) string {
+	return composite.Keys() + ":" + path + "?" + query.Encode() + "#" + scope
+}
+
+func variantKey(key string, vary []string, header http.Header) string {
+	values := []string{}
+	for _, name := range vary {
+		values = append(values, name+"="+strings.Join(header.Values(name), ","))
+	}
+
+	return key + "|" + strings.Join(values, "&")
+}
+
+func varyNames(header http.Header) []string {
+	names := []string{}
+	for _, val := range header.Values("Vary") {
+		for _, name := range strings.Split(val, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// cacheTTL tells whether the response may be cached and for how long. The max-age of the
+// response wins over the TTL of the policy, private responses are only cached when scoped.
+func cacheTTL(recorder *teeRecorder, composite *service.Composite, path string, scope string) (time.Duration, bool) {
+	if recorder.status != http.StatusOK || recorder.overflow || recorder.header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+
+	for _, name := range varyNames(recorder.header) {
+		if name == "*" {
+			return 0, false
+		}
+	}
+
+	directives := cacheDirectives(recorder.header)
+	for _, key := range []string{"no-store", "no-cache"} {
+		if _, ok := directives[key]; ok {
+			return 0, false
+		}
+	}
+
+	if _, ok := directives["private"]; ok && scope == "" {
+		return 0, false
+	}
+
+	for _, key := range []string{"s-maxage", "max-age"} {
+		if val, ok := directives[key]; ok {
+			age, err := strconv.Atoi(val)
+			return time.Duration(age) * time.Second, err == nil && age > 0
+		}
+	}
+
+	ttl := composite.CacheTTL(path)
+	return ttl, ttl > 0
+}
+
+func cacheDirectives(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, val := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(val, ",") {
+			parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+			if parts[0] == "" {
+				continue
+			}
+
+			if len(parts) == 1 {
+				directives[strings.ToLower(parts[0])] = ""
+				continue
+			}
+
+			directives[strings.ToLower(parts[0])] = strings.Trim(parts[1], `"`)
+		}
+	}
+
+	return directives
+}
+
+// teeRecorder streams the response to the client while keeping a copy of it. The headers of
+// the service are recorded apart from the ones already set by the gateway.
+type teeRecorder struct {
+	http.ResponseWriter
+	header      http.Header
+	status      int
+	wroteHeader bool
+	overflow    bool
+	body        bytes.Buffer
+}
+
+func (w *teeRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *teeRecorder) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.status = code
+	w.wroteHeader = true
+
+	for key, vals := range w.header {
+		w.ResponseWriter.Header()[key] = vals
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *teeRecorder) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+
+	if !w.overflow {
+		if w.body.Len()+len(b) > maxRecordedBody {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *teeRecorder) Flush() {
+	w.WriteHeader(http.StatusOK)
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// adminOnly guards the administration endpoints with the token of APP_ADMIN_TOKEN, they're
+// disabled when it isn't set.
+func (fwd chiForwarder) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := helper.Env(libs.AppAdminToken, "")
+		if token == "" {
+			fwd.failure(w, r, http.StatusNotFound, "Jalur tidak ditemukan")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(models.AdminTokenHeaderKey)), []byte(token)) != 1 {
+			fwd.failure(w, r, http.StatusUnauthorized, "Akses ditolak")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// purgeCache drops the cached responses of a service, or only those of its paths starting with
+// the prefix. Paths are the ones sent to the service, once the endpoint is trimmed and rewritten.
+func (fwd chiForwarder) purgeCache(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("service")
+	if name == "" {
+		fwd.failure(w, r, http.StatusBadRequest, "Layanan harus diisi")
+		return
+	}
+
+	prefix := name + ":"
+	if path := r.URL.Query().Get("prefix"); path != "" {
+		prefix += "/" + strings.TrimLeft(path, "/")
+	}
+
+	count, err := fwd.responses().Purge(prefix)
+	if err != nil {
+		L.Err(serror.NewFromErrorc(err, "while purging cache"))
+		fwd.failure(w, r, http.StatusInternalServerError, "Gagal menghapus cache")
+		return
+	}
+
+	L.Infof("%d cache entries of %s are purged", count, prefix)
+
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(http.StatusOK)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   http.StatusOK,
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     map[string]int{"purged": count},
+	}))
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"net/url"
+
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// Split applies the traffic policy, it takes effect for the next requests without remounting.
+func (fwd *chiForwarder) Split(policy service.TrafficPolicy) {
+	err := policy.Validate()
+	if err != nil {
+		L.Warnf("ignoring traffic policy: %v", err)
+		return
+	}
+
+	fwd.mutex.Lock()
+	fwd.snapshot.Store(fwd.table().withSplit(policy))
+	fwd.mutex.Unlock()
+
+	if policy.IsActive() {
+		L.Infof("service %s sends %d%% of its traffic to %s", policy.Stable, policy.Weight, policy.Canary)
+	} else {
+		L.Infof("service %s doesn't split its traffic anymore", policy.Stable)
+	}
+}
+
+// trafficSplit runs after authorization so that cohorts can be picked from the authorization info.
+// The request was validated and authorized against the stable composite, requests sent to the
+// canary go through its own rewrites, routes and protection again.
+func (fwd chiForwarder) trafficSplit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
+
+		canary, policy, ok := fwd.table().canaryOf(composite)
+		if !ok || !isCanaryRequest(r, policy) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// a canary being drained leaves its requests to the stable composite.
+		release, ok := canary.Acquire()
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer release()
+
+		rest := trimEndpoint(r.URL.EscapedPath(), composite.Endpoints())
+		if unescaped, err := url.PathUnescape(rest); err == nil {
+			rest = unescaped
+		}
+
+		stablePath := r.Context().Value(models.PathContextValueKey).(string)
+		authorized := fwd.authMethodOf(composite, r.Method, stablePath)
+
+		path := canary.Rewrite(rest)
+		r = r.WithContext(context.WithValue(r.Context(), models.ServiceContextValueKey, canary))
+		r = r.WithContext(context.WithValue(r.Context(), models.PathContextValueKey, path))
+
+		// the authorization of the stable composite holds unless the canary asks for another one.
+		handler := next
+		if method := fwd.authMethodOf(canary, r.Method, path); method != "" && method != authorized {
+			handler = fwd.authorization(next)
+		}
+
+		fwd.routeValidation(handler).ServeHTTP(w, r)
+	})
+}
+
+func isCanaryRequest(r *http.Request, policy service.TrafficPolicy) bool {
+	if policy.Header != "" {
+		if val := r.Header.Get(policy.Header); val != "" && (policy.HeaderValue == "" || val == policy.HeaderValue) {
+			return true
+		}
+	}
+
+	if policy.Cookie != "" {
+		if cookie, err := r.Cookie(policy.Cookie); err == nil && (policy.CookieValue == "" || cookie.Value == policy.CookieValue) {
+			return true
+		}
+	}
+
+	if policy.Weight <= 0 {
+		return false
+	}
+
+	if policy.Cohort == "" {
+		return rand.Intn(100) < policy.Weight
+	}
+
+	// requests without identity stay on the stable composite, the cohort of a user must not change
+	// from one request to the other.
+	authInfo, ok := r.Context().Value(models.AuthorizationInfoContextValueKey).(*models.AuthorizationInfo)
+	if !ok {
+		return false
+	}
+
+	id := authInfo.UserID
+	if policy.Cohort == service.CohortOrganization {
+		id = authInfo.OrganizationId
+	}
+
+	if id == "" {
+		return false
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(policy.Stable + ":" + id))
+
+	return int(h.Sum32()%100) < policy.Weight
+}
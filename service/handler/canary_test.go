@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+func TestIsCanaryRequest(t *testing.T) {
+	user := &models.AuthorizationInfo{UserID: "u1", OrganizationId: "o1"}
+
+	tests := []struct {
+		name   string
+		policy service.TrafficPolicy
+		header http.Header
+		auth   *models.AuthorizationInfo
+		want   bool
+	}{
+		{"header", service.TrafficPolicy{Header: "X-Canary"}, http.Header{"X-Canary": {"1"}}, nil, true},
+		{"header value", service.TrafficPolicy{Header: "X-Canary", HeaderValue: "yes"}, http.Header{"X-Canary": {"yes"}}, nil, true},
+		{"other header value", service.TrafficPolicy{Header: "X-Canary", HeaderValue: "yes"}, http.Header{"X-Canary": {"no"}}, nil, false},
+		{"cookie", service.TrafficPolicy{Cookie: "canary", CookieValue: "on"}, http.Header{"Cookie": {"canary=on"}}, nil, true},
+		{"other cookie value", service.TrafficPolicy{Cookie: "canary", CookieValue: "on"}, http.Header{"Cookie": {"canary=off"}}, nil, false},
+		{"no weight", service.TrafficPolicy{Weight: 0}, http.Header{}, user, false},
+		{"whole weight", service.TrafficPolicy{Weight: 100}, http.Header{}, nil, true},
+		{"user cohort", service.TrafficPolicy{Stable: "a", Weight: 100, Cohort: service.CohortUser}, http.Header{}, user, true},
+		{"organization cohort", service.TrafficPolicy{Stable: "a", Weight: 100, Cohort: service.CohortOrganization}, http.Header{}, user, true},
+		{"cohort without identity", service.TrafficPolicy{Stable: "a", Weight: 100, Cohort: service.CohortUser}, http.Header{}, nil, false},
+		{"cohort without user", service.TrafficPolicy{Stable: "a", Weight: 100, Cohort: service.CohortUser}, http.Header{}, &models.AuthorizationInfo{OrganizationId: "o1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/devices", nil)
+			r.Header = tt.header
+			if tt.auth != nil {
+				r = r.WithContext(context.WithValue(r.Context(), models.AuthorizationInfoContextValueKey, tt.auth))
+			}
+
+			if got := isCanaryRequest(r, tt.policy); got != tt.want {
+				t.Errorf("isCanaryRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCanaryRequestCohortIsStable(t *testing.T) {
+	policy := service.TrafficPolicy{Stable: "a", Canary: "b", Weight: 50, Cohort: service.CohortUser}
+
+	for _, id := range []string{"u1", "u2", "u3", "u4"} {
+		r := httptest.NewRequest(http.MethodGet, "/devices", nil)
+		r = r.WithContext(context.WithValue(r.Context(), models.AuthorizationInfoContextValueKey, &models.AuthorizationInfo{UserID: id}))
+
+		first := isCanaryRequest(r, policy)
+		for i := 0; i < 10; i++ {
+			if isCanaryRequest(r, policy) != first {
+				t.Fatalf("user %s switched composite", id)
+			}
+		}
+	}
+}
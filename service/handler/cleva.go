@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/packets"
+)
+
+// Call serves Cleva.Call, the call is served like a REST request of the same method and path by
+// the middlewares of the chi forwarder, e.g. /devices/items/1 is dispatched as /items/1 to the
+// devices service. Credentials and other headers are taken from the incoming metadata.
+func (ingress grpcIngress) Call(ctx context.Context, req *packets.Request) (*packets.Response, error) {
+	u, err := url.Parse(req.Path)
+	if err != nil || !strings.HasPrefix(u.Path, "/") {
+		return envelope(http.StatusBadRequest, "Jalur tidak valid", req)
+	}
+
+	r, err := http.NewRequestWithContext(withRoutePath(ctx, u.Path), strings.ToUpper(req.Method), u.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return envelope(http.StatusBadRequest, "Metode tidak valid", req)
+	}
+	r.RequestURI = u.RequestURI()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, vals := range md {
+		if isReservedGrpcHeader(key) || strings.HasPrefix(key, "grpc-") || key == "te" {
+			continue
+		}
+
+		for _, val := range vals {
+			r.Header.Add(key, val)
+		}
+	}
+
+	r.Host = first(md.Get(":authority"))
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	recorder := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+	ingress.fwd.agentIdentification(ingress.fwd.chain).ServeHTTP(recorder, r)
+
+	header := metadata.MD{}
+	for key, vals := range recorder.header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Connection", "Transfer-Encoding":
+			continue
+
+		case http.CanonicalHeaderKey(models.ContentTypeHeaderKey):
+			key = models.BvContentTypeHeaderKey
+		}
+
+		header.Append(strings.ToLower(key), vals...)
+	}
+
+	if len(header) > 0 {
+		logger(grpc.SendHeader(ctx, header))
+	}
+
+	L.Infof("call %s has been served with %d", req.Path, recorder.status)
+	return &packets.Response{
+		Server: hostname(),
+		Status: int32(recorder.status),
+		Body:   recorder.body.Bytes(),
+	}, nil
+}
+
+// withRoutePath binds the path to the context the way chi does for /*, so that requests made by
+// the gateway itself go through the middlewares of the forwarder.
+func withRoutePath(ctx context.Context, path string) context.Context {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("*", strings.TrimPrefix(path, "/"))
+
+	return context.WithValue(ctx, chi.RouteCtxKey, rctx)
+}
+
+func envelope(code int, message string, req *packets.Request) (*packets.Response, error) {
+	body, err := json.Marshal(models.Response{
+		Response:   code,
+		Error:      message,
+		Controller: req.Path,
+		Action:     req.Method,
+		Result:     "",
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "while marshaling json: %v", err)
+	}
+
+	return &packets.Response{
+		Server: hostname(),
+		Status: int32(code),
+		Body:   body,
+	}, nil
+}
+
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "?"
+	}
+
+	return host
+}
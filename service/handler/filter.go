@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// Filter extends the processing of the requests of a service. A filter implements any of
+// RequestFilter, ResponseFilter and ErrorFilter, filters are attached to a service by name in its
+// registry entry and run in the declared order, the response phase runs in reverse order.
+type Filter interface{}
+
+// FilterFactory creates a filter from the options of the registry entry, it's called whenever the
+// service is mounted.
+type FilterFactory func(options json.RawMessage) (Filter, error)
+
+// RequestFilter runs once the request is authorized, it may return a modified request. Returning
+// an error stops the request.
+type RequestFilter interface {
+	OnRequest(r *http.Request) (*http.Request, error)
+}
+
+// ResponseFilter may modify the response of the service. Responses of services with response
+// filters are buffered, they aren't streamed anymore.
+type ResponseFilter interface {
+	OnResponse(r *http.Request, res *FilterResponse) error
+}
+
+// ErrorFilter runs when a filter fails or the request ends with a server error, whether the gateway
+// couldn't reach the service or the service answered 5xx. It may change the answer sent to the
+// client, server errors left unchanged reach the client as they were answered.
+type ErrorFilter interface {
+	OnError(r *http.Request, err *FilterError)
+}
+
+// BodyLimiter is implemented by filters bounding the body of the requests, the smallest bound of
+// the chain is enforced as soon as the service is identified, before anything reads the body.
+type BodyLimiter interface {
+	MaxBodyBytes() int64
+}
+
+type FilterResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// FilterError is returned by filters to stop the request with the given status, other errors are
+// answered with 500. Header holds the headers added to the answer.
+type FilterError struct {
+	Status  int
+	Message string
+	Header  http.Header
+}
+
+func NewFilterError(status int, message string) *FilterError {
+	return &FilterError{
+		Status:  status,
+		Message: message,
+		Header:  http.Header{},
+	}
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+var filterFactories = struct {
+	sync.RWMutex
+	factories map[string]FilterFactory
+}{factories: make(map[string]FilterFactory)}
+
+// RegisterFilter makes a filter available to the registry entries under the given name, it's
+// meant to be called from init functions and panics if the name is already taken.
+func RegisterFilter(name string, factory FilterFactory) {
+	filterFactories.Lock()
+	defer filterFactories.Unlock()
+
+	if _, ok := filterFactories.factories[name]; ok {
+		panic(fmt.Sprintf("filter %s is already registered", name))
+	}
+
+	filterFactories.factories[name] = factory
+}
+
+func filterFactory(name string) (FilterFactory, bool) {
+	filterFactories.RLock()
+	defer filterFactories.RUnlock()
+
+	factory, ok := filterFactories.factories[name]
+	return factory, ok
+}
+
+// filterChain holds the filters of a composite. A chain which couldn't be built rejects every
+// request rather than letting them through without their filters.
+type filterChain struct {
+	filters     []Filter
+	hasResponse bool
+	hasError    bool
+	err         error
+	// maxBody is the smallest bound of the BodyLimiter filters, zero when there's none.
+	maxBody int64
+}
+
+func newFilterChain(composite *service.Composite) *filterChain {
+	chain := &filterChain{}
+	for _, cfg := range composite.Config().Filters {
+		factory, ok := filterFactory(cfg.Name)
+		if !ok {
+			chain.err = fmt.Errorf("unknown filter %s", cfg.Name)
+			break
+		}
+
+		filter, err := factory(cfg.Options)
+		if err != nil {
+			chain.err = fmt.Errorf("while creating filter %s: %v", cfg.Name, err)
+			break
+		}
+
+		if _, ok := filter.(ResponseFilter); ok {
+			chain.hasResponse = true
+		}
+
+		if _, ok := filter.(ErrorFilter); ok {
+			chain.hasError = true
+		}
+
+		if f, ok := filter.(BodyLimiter); ok && (chain.maxBody == 0 || f.MaxBodyBytes() < chain.maxBody) {
+			chain.maxBody = f.MaxBodyBytes()
+		}
+
+		chain.filters = append(chain.filters, filter)
+	}
+
+	if chain.err != nil {
+		L.Warnf("filters of service %s are invalid, its requests are rejected: %v", composite.Keys(), chain.err)
+	}
+
+	return chain
+}
+
+// limitBody bounds the body of the request to the limit of the filter chain of the composite, it
+// runs before authorization and idempotency read the body. Bodies of unknown length are read
+// upfront to be measured.
+func (fwd chiForwarder) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
+
+		chain := fwd.table().chainOf(composite)
+		if chain == nil || chain.maxBody == 0 || r.Body == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > chain.maxBody {
+			fwd.failure(w, r, http.StatusRequestEntityTooLarge, "Permintaan terlalu besar")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, chain.maxBody)
+		if r.ContentLength < 0 {
+			body, err := ioutil.ReadAll(r.Body)
+			switch {
+			case err != nil && int64(len(body)) >= chain.maxBody:
+				fwd.failure(w, r, http.StatusRequestEntityTooLarge, "Permintaan terlalu besar")
+				return
+
+			case err != nil:
+				fwd.failure(w, r, http.StatusBadRequest, "Gagal membaca permintaan")
+				return
+			}
+
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// applyFilters runs the filter chain of the composite around the rest of the request.
+func (fwd chiForwarder) applyFilters(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
+
+		chain := fwd.table().chainOf(composite)
+		if chain == nil || (len(chain.filters) == 0 && chain.err == nil) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if chain.err != nil {
+			fwd.failure(w, r, http.StatusInternalServerError, "Konfigurasi layanan tidak valid")
+			return
+		}
+
+		for _, filter := range chain.filters {
+			if f, ok := filter.(RequestFilter); ok {
+				req, err := f.OnRequest(r)
+				if err != nil {
+					fwd.filterFailure(w, r, chain, err)
+					return
+				}
+
+				if req != nil {
+					r = req
+				}
+			}
+		}
+
+		if !chain.hasResponse && !chain.hasError {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !chain.hasResponse {
+			recorder := &failureRecorder{ResponseWriter: w, header: http.Header{}}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.failed {
+				fwd.serverFailure(w, r, chain, recorder.status, recorder.header, recorder.body.Bytes())
+			}
+			return
+		}
+
+		recorder := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if chain.hasError && recorder.status >= http.StatusInternalServerError {
+			fwd.serverFailure(w, r, chain, recorder.status, recorder.header, recorder.body.Bytes())
+			return
+		}
+
+		res := &FilterResponse{
+			Status: recorder.status,
+			Header: recorder.header,
+			Body:   recorder.body.Bytes(),
+		}
+
+		for i := len(chain.filters) - 1; i >= 0; i-- {
+			if f, ok := chain.filters[i].(ResponseFilter); ok {
+				err := f.OnResponse(r, res)
+				if err != nil {
+					fwd.filterFailure(w, r, chain, err)
+					return
+				}
+			}
+		}
+
+		for key, vals := range res.Header {
+			w.Header()[key] = vals
+		}
+
+		if w.Header().Get("Content-Length") != "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(res.Body)))
+		}
+
+		w.WriteHeader(res.Status)
+		_, err := w.Write(res.Body)
+		logger(err)
+	})
+}
+
+func (fwd chiForwarder) filterFailure(w http.ResponseWriter, r *http.Request, chain *filterChain, err error) {
+	var filterErr *FilterError
+	if !errors.As(err, &filterErr) {
+		L.Warnf("while filtering request %s: %v", r.RequestURI, err)
+		filterErr = NewFilterError(http.StatusInternalServerError, "Kesalahan pada server")
+	}
+
+	if filterErr.Header == nil {
+		filterErr.Header = http.Header{}
+	}
+
+	chain.onError(r, filterErr)
+
+	for key, vals := range filterErr.Header {
+		w.Header()[key] = vals
+	}
+
+	fwd.failure(w, r, filterErr.Status, filterErr.Message)
+}
+
+// serverFailure runs the error phase over a server error answered by the gateway or the service,
+// the response filters are skipped. The response is sent as it was answered unless an error
+// filter changes it.
+func (fwd chiForwarder) serverFailure(w http.ResponseWriter, r *http.Request, chain *filterChain, status int, header http.Header, body []byte) {
+	message := http.StatusText(status)
+
+	res := models.Response{}
+	if err := json.Unmarshal(body, &res); err == nil && res.Error != "" {
+		message = res.Error
+	}
+
+	filterErr := NewFilterError(status, message)
+	chain.onError(r, filterErr)
+
+	if filterErr.Status == status && filterErr.Message == message && len(filterErr.Header) == 0 {
+		for key, vals := range header {
+			w.Header()[key] = vals
+		}
+
+		w.WriteHeader(status)
+		_, err := w.Write(body)
+		logger(err)
+		return
+	}
+
+	for key, vals := range filterErr.Header {
+		w.Header()[key] = vals
+	}
+
+	fwd.failure(w, r, filterErr.Status, filterErr.Message)
+}
+
+func (chain *filterChain) onError(r *http.Request, err *FilterError) {
+	for _, filter := range chain.filters {
+		if f, ok := filter.(ErrorFilter); ok {
+			f.OnError(r, err)
+		}
+	}
+}
+
+// bufferedResponse holds the response of the service until the response filters have run.
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *bufferedResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponse) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+}
+
+func (w *bufferedResponse) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponse) Flush() {}
+
+// failureRecorder streams the response to the client unless it's a server error, which is held
+// for the error phase.
+type failureRecorder struct {
+	http.ResponseWriter
+	header      http.Header
+	status      int
+	wroteHeader bool
+	failed      bool
+	body        bytes.Buffer
+}
+
+func (w *failureRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *failureRecorder) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.status = code
+	w.wroteHeader = true
+
+	if code >= http.StatusInternalServerError {
+		w.failed = true
+		return
+	}
+
+	for key, vals := range w.header {
+		w.ResponseWriter.Header()[key] = vals
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *failureRecorder) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+
+	if w.failed {
+		return w.body.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *failureRecorder) Flush() {
+	w.WriteHeader(http.StatusOK)
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && !w.failed {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,421 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	protov1 "github.com/golang/protobuf/proto"
+	"go.elastic.co/apm/module/apmgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/uzzeet/uzzeet-gateway/controller/auth"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/packets"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// frame is an opaque gRPC message, the ingress forwards frames without decoding them.
+type frame struct {
+	payload []byte
+}
+
+// proxyCodec passes frames through untouched and falls back to protobuf for every other message,
+// so that services registered on the ingress server itself keep working.
+type proxyCodec struct{}
+
+func (proxyCodec) Marshal(v interface{}) ([]byte, error) {
+	if f, ok := v.(*frame); ok {
+		return f.payload, nil
+	}
+
+	msg, ok := v.(protov1.Message)
+	if !ok {
+		return nil, fmt.Errorf("unsupported message %T", v)
+	}
+
+	return protov1.Marshal(msg)
+}
+
+func (proxyCodec) Unmarshal(data []byte, v interface{}) error {
+	if f, ok := v.(*frame); ok {
+		f.payload = append([]byte(nil), data...)
+		return nil
+	}
+
+	msg, ok := v.(protov1.Message)
+	if !ok {
+		return fmt.Errorf("unsupported message %T", v)
+	}
+
+	return protov1.Unmarshal(data, msg)
+}
+
+func (proxyCodec) Name() string {
+	return "proto"
+}
+
+func (proxyCodec) String() string {
+	return "proto"
+}
+
+type grpcIngress struct {
+	fwd *chiForwarder
+}
+
+// NewGrpcIngress creates the gRPC server of the gateway. It serves Cleva.Call and proxies calls
+// to services it doesn't know to the composite owning the requested service. It shares
+// composites with the given chi forwarder.
+func NewGrpcIngress(fwd service.Forwarder) (*grpc.Server, error) {
+	chiFwd, ok := fwd.(*chiForwarder)
+	if !ok {
+		return nil, errors.New("grpc ingress requires a forwarder created by NewChiForwarder")
+	}
+
+	ingress := &grpcIngress{chiFwd}
+
+	server := grpc.NewServer(
+		grpc.CustomCodec(proxyCodec{}),
+		grpc.UnaryInterceptor(apmgrpc.NewUnaryServerInterceptor(apmgrpc.WithRecovery())),
+		grpc.UnknownServiceHandler(ingress.proxy),
+	)
+	packets.RegisterClevaServer(server, ingress)
+
+	return server, nil
+}
+
+func (ingress grpcIngress) proxy(srv interface{}, stream grpc.ServerStream) error {
+	fullMethod, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "unknown method")
+	}
+
+	serviceName := strings.Split(strings.Trim(fullMethod, "/"), "/")[0]
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	var (
+		composite *service.Composite
+		release   func()
+	)
+	for acquired := false; !acquired; {
+		composite = ingress.fwd.table().lookupService(serviceName, first(md.Get(models.PreviewHeaderKey)))
+		if composite == nil {
+			return status.Errorf(codes.Unimplemented, "service %s is not registered", serviceName)
+		}
+
+		release, acquired = composite.Acquire()
+	}
+	defer release()
+
+	method := composite.MethodAuth(fullMethod)
+	request := models.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: fullMethod},
+	}
+
+	// signatures of typed calls cover their first message as body, it's read upfront to be verified
+	// and sent first.
+	var head *frame
+	eof := false
+	client := ""
+	if authService, ok := ingress.fwd.authServiceOf(method); ok && verifiesSignature(authService) {
+		client = first(md.Get(models.ClientIDHeaderKey))
+
+		head = &frame{}
+		err := stream.RecvMsg(head)
+		switch {
+		case err == io.EOF:
+			head, eof = nil, true
+
+		case err != nil:
+			return err
+
+		default:
+			request.Body = head.payload
+		}
+	}
+
+	// limits by IP are applied before the call is authorized, so that calls failing authorization
+	// use them up as well. Their state is sent along the header.
+	header := http.Header{}
+	err := ingress.admit(stream, header, composite, fullMethod, "", nil, true)
+
+	ctx := stream.Context()
+	var authInfo *models.AuthorizationInfo
+	if err == nil {
+		ctx, authInfo, err = ingress.outgoingContext(ctx, composite, method, client, request)
+	}
+
+	if err == nil {
+		err = ingress.admit(stream, header, composite, fullMethod, client, authInfo, false)
+	}
+
+	state := metadata.MD{}
+	for key, vals := range header {
+		state.Append(strings.ToLower(key), vals...)
+	}
+
+	logger(stream.SetHeader(state))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	clientStream, err := composite.Connection.NewStream(ctx, &grpc.StreamDesc{
+		ServerStreams: true,
+		ClientStreams: true,
+	}, fullMethod, grpc.CallCustomCodec(proxyCodec{}))
+	if err != nil {
+		return err
+	}
+
+	upstream := make(chan error, 1)
+	go func() {
+		if head != nil {
+			err := clientStream.SendMsg(head)
+			if err != nil {
+				upstream <- err
+				return
+			}
+		}
+
+		if eof {
+			upstream <- clientStream.CloseSend()
+			return
+		}
+
+		for {
+			f := &frame{}
+			err := stream.RecvMsg(f)
+			if err != nil {
+				if err == io.EOF {
+					err = clientStream.CloseSend()
+				}
+
+				upstream <- err
+				return
+			}
+
+			err = clientStream.SendMsg(f)
+			if err != nil {
+				upstream <- err
+				return
+			}
+		}
+	}()
+
+	downstream := make(chan error, 1)
+	go func() {
+		header, err := clientStream.Header()
+		if err != nil {
+			downstream <- err
+			return
+		}
+
+		err = stream.SendHeader(header)
+		if err != nil {
+			downstream <- err
+			return
+		}
+
+		for {
+			f := &frame{}
+			err := clientStream.RecvMsg(f)
+			if err != nil {
+				downstream <- err
+				return
+			}
+
+			err = stream.SendMsg(f)
+			if err != nil {
+				downstream <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-upstream:
+			if _, ok := status.FromError(err); ok && err != nil {
+				return err
+			}
+
+			if err != nil {
+				return status.Errorf(codes.Internal, "while forwarding request: %v", err)
+			}
+
+			// the client has finished sending, keep relaying the response.
+			upstream = nil
+
+		case err := <-downstream:
+			stream.SetTrailer(clientStream.Trailer())
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// admit applies the rate limits by IP of the composite to the call when anonymous, its other rate
+// limits and the quotas of the caller otherwise, the same way the chi forwarder does for REST
+// requests. Their state is described in header.
+func (ingress grpcIngress) admit(stream grpc.ServerStream, header http.Header, composite *service.Composite, fullMethod string, client string, authInfo *models.AuthorizationInfo, anonymous bool) error {
+	ip := ""
+	if p, ok := peer.FromContext(stream.Context()); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	res, ok := ingress.fwd.limitRate(composite, http.MethodPost, fullMethod, anonymous, func(limit service.RateLimit) string {
+		return rateLimitIdentity(limit, ip, client, authInfo)
+	})
+	if res != nil {
+		setRateLimitHeaders(header, *res)
+	}
+
+	if !ok {
+		L.Warnf("call %s exceeds rate limits of service %s", fullMethod, composite.Keys())
+		header.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		return status.Error(codes.ResourceExhausted, "Terlalu banyak permintaan")
+	}
+
+	if authInfo == nil {
+		return nil
+	}
+
+	quotas, usages, code := ingress.fwd.meterUsage(authInfo, fullMethod)
+	setQuotaHeaders(header, quotas, usages)
+
+	switch code {
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, "Kuota bulanan habis")
+
+	case http.StatusTooManyRequests:
+		_, _, left := usagePeriod(time.Now())
+		header.Set("Retry-After", strconv.Itoa(ceilSeconds(left)))
+		return status.Error(codes.ResourceExhausted, "Kuota harian habis")
+	}
+
+	return nil
+}
+
+// outgoingContext authorizes the incoming call and builds the metadata sent to the composite,
+// it mirrors what the HTTP forwarder sends along with Dispatch, signed authorization info
+// included. Credentials of the request are taken from the incoming metadata, the client ID is only
+// forwarded once the auth service verified its signature.
+func (ingress grpcIngress) outgoingContext(ctx context.Context, composite *service.Composite, method string, client string, request models.Request) (context.Context, *models.AuthorizationInfo, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	out := metadata.MD{}
+	for key, vals := range md {
+		key = strings.ToLower(key)
+		switch {
+		case strings.HasPrefix(key, ":"), strings.HasPrefix(key, "grpc-"),
+			key == "content-type", key == "user-agent", key == "te", key == "connection",
+			key == models.ClientInfoContextValueKey, key == models.AuthorizationInfoContextValueKey,
+			key == models.AuthorizationSignatureValueKey, key == models.BvRealIPTypeHeaderKey,
+			key == models.BvRealIPProofTypeHeaderKey, key == models.BvXRemoteAddrTypeHeaderKey:
+			continue
+		}
+
+		out[key] = vals
+	}
+
+	var agent string
+	if vals := md.Get(models.UserAgentHeaderKey); len(vals) > 0 {
+		agent = strings.Split(vals[0], "/")[0]
+	}
+
+	b, err := json.Marshal(&models.ClientInfo{
+		ClientID: client,
+		Agent:    agent,
+	})
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "while marshaling json: %v", err)
+	}
+	out.Set(models.ClientInfoContextValueKey, string(b))
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr := p.Addr.String()
+		out.Set(models.BvXRemoteAddrTypeHeaderKey, remoteAddr)
+
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			remoteAddr = host
+		}
+
+		isPrivate, errx := isPrivateAddress(remoteAddr)
+		out.Set(models.BvRealIPTypeHeaderKey, remoteAddr)
+		out.Set(models.BvRealIPProofTypeHeaderKey, helper.BoolToString(!isPrivate && errx == nil))
+	}
+
+	var authInfo *models.AuthorizationInfo
+	if authService, ok := ingress.fwd.authServiceOf(method); ok {
+		request.CompositeID = models.CompositeID(first(md.Get(models.ClientIDHeaderKey)))
+		request.Token = first(md.Get(models.AuthorizationHeaderKey))
+		request.Timestamp, _ = time.Parse(models.TimestampFormat, first(md.Get(models.TimestampHeaderKey)))
+		request.Signature = first(md.Get(models.SignatureHeaderKey))
+
+		authInfo, err = authService.Authorize(request)
+		if err != nil {
+			if erx, ok := err.(auth.AuthorizationError); ok {
+				return nil, nil, status.Error(codes.Unauthenticated, erx.Message()["id"])
+			}
+
+			return nil, nil, status.Errorf(codes.Internal, "while authorizing: %v", err)
+		}
+
+		b, err := json.Marshal(authInfo)
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "while marshaling json: %v", err)
+		}
+		out.Set(models.AuthorizationInfoContextValueKey, string(b))
+		if signature := composite.SignIdentity(string(b)); signature != "" {
+			out.Set(models.AuthorizationSignatureValueKey, signature)
+		}
+	}
+
+	return metadata.NewOutgoingContext(ctx, out), authInfo, nil
+}
+
+func first(vals []string) string {
+	if len(vals) > 0 {
+		return vals[0]
+	}
+
+	return ""
+}
+
+func (fwd chiForwarder) authServiceOf(method string) (auth.Service, bool) {
+	switch method {
+	case "strict":
+		return fwd.strictAuthService, true
+
+	case "private":
+		return fwd.privateAuthService, true
+
+	case "protect":
+		return fwd.authService, true
+	}
+
+	return nil, false
+}
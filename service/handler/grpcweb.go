@@ -0,0 +1,388 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	"github.com/uzzeet/uzzeet-gateway/packets"
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+	clevaCallMethod        = "/packets.Cleva/Call"
+
+	grpcWebTrailerFlag  byte = 0x80
+	grpcWebCompressFlag byte = 0x01
+)
+
+// grpcWeb serves gRPC-Web calls, both binary and text framings. Calls to /packets.Cleva/Call are
+// resolved to a composite like any REST request, other methods are proxied to the composite owning
+// the typed service, exactly like the gRPC ingress does.
+func (fwd chiForwarder) grpcWeb(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType, ok := grpcWebContentTypeOf(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		stream, err := newWebStream(w, r, contentType)
+		if err != nil {
+			stream.finish(err)
+			return
+		}
+
+		ingress := grpcIngress{&fwd}
+		if stream.method == clevaCallMethod {
+			stream.finish(ingress.webCall(stream))
+			return
+		}
+
+		stream.finish(ingress.proxy(nil, stream))
+	})
+}
+
+func (ingress grpcIngress) webCall(stream *webStream) error {
+	req := &packets.Request{}
+	err := stream.RecvMsg(req)
+	if _, ok := status.FromError(err); ok && err != nil {
+		return err
+	}
+
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "while reading request: %v", err)
+	}
+
+	res, err := ingress.Call(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendMsg(res)
+}
+
+func grpcWebContentTypeOf(r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		return "", false
+	}
+
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]))
+	switch contentType {
+	case grpcWebContentType, grpcWebContentType + "+proto",
+		grpcWebTextContentType, grpcWebTextContentType + "+proto":
+		return contentType, true
+	}
+
+	return "", false
+}
+
+// webStream adapts a gRPC-Web HTTP exchange to grpc.ServerStream. Browsers can't stream requests,
+// so the whole request body is read upfront, up to APP_GRPC_WEB_MAX_BODY, while responses are
+// flushed frame by frame.
+type webStream struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	method      string
+	w           http.ResponseWriter
+	body        *bytes.Reader
+	text        bool
+	contentType string
+	header      metadata.MD
+	trailer     metadata.MD
+	wroteHeader bool
+}
+
+// webTransport exposes the stream to grpc.SendHeader and friends, which grpc.ServerStream can't do
+// since both interfaces declare SetTrailer with different signatures.
+type webTransport struct {
+	*webStream
+}
+
+func (t webTransport) Method() string {
+	return t.method
+}
+
+func (t webTransport) SetTrailer(md metadata.MD) error {
+	t.webStream.SetTrailer(md)
+	return nil
+}
+
+func newWebStream(w http.ResponseWriter, r *http.Request, contentType string) (*webStream, error) {
+	stream := &webStream{
+		ctx:         r.Context(),
+		cancel:      func() {},
+		method:      r.URL.Path,
+		w:           w,
+		body:        bytes.NewReader(nil),
+		text:        strings.HasPrefix(contentType, grpcWebTextContentType),
+		contentType: contentType,
+		header:      metadata.MD{},
+		trailer:     metadata.MD{},
+	}
+
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		stream.method = rctx.RoutePath
+	}
+
+	md := metadata.MD{}
+	for key, vals := range r.Header {
+		md.Append(strings.ToLower(key), vals...)
+	}
+
+	if agent := r.Header.Get("X-User-Agent"); agent != "" {
+		md.Set("user-agent", agent)
+	}
+
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+
+	if timeout, ok := grpcTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		ctx, stream.cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, stream.cancel = context.WithCancel(ctx)
+	}
+
+	stream.ctx = grpc.NewContextWithServerTransportStream(ctx, webTransport{stream})
+
+	maxBody := helper.StringToInt(helper.Env(libs.AppGrpcWebMaxBody, "4194304"), 4194304)
+	if r.ContentLength > maxBody {
+		return stream, status.Errorf(codes.ResourceExhausted, "request is larger than %d bytes", maxBody)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		return stream, status.Errorf(codes.InvalidArgument, "while reading body: %v", err)
+	}
+
+	if int64(len(body)) > maxBody {
+		return stream, status.Errorf(codes.ResourceExhausted, "request is larger than %d bytes", maxBody)
+	}
+
+	if stream.text {
+		body, err = decodeWebText(body)
+		if err != nil {
+			return stream, status.Errorf(codes.InvalidArgument, "while decoding body: %v", err)
+		}
+	}
+	stream.body = bytes.NewReader(body)
+
+	return stream, nil
+}
+
+func (s *webStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *webStream) SetHeader(md metadata.MD) error {
+	if s.wroteHeader {
+		return status.Error(codes.Internal, "header has been sent")
+	}
+
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *webStream) SendHeader(md metadata.MD) error {
+	err := s.SetHeader(md)
+	if err != nil {
+		return err
+	}
+
+	s.writeHeader()
+	return nil
+}
+
+func (s *webStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *webStream) SendMsg(m interface{}) error {
+	payload, err := proxyCodec{}.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	s.writeHeader()
+	return s.writeFrame(0, payload)
+}
+
+func (s *webStream) RecvMsg(m interface{}) error {
+	prefix := make([]byte, 5)
+	_, err := io.ReadFull(s.body, prefix)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return status.Error(codes.InvalidArgument, "truncated message")
+		}
+
+		return err
+	}
+
+	if prefix[0]&grpcWebCompressFlag != 0 {
+		return status.Error(codes.Unimplemented, "compressed messages are not supported")
+	}
+
+	// the length is the client's word, it can't claim more than what's left of the body.
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if int64(length) > int64(s.body.Len()) {
+		return status.Errorf(codes.ResourceExhausted, "message of %d bytes exceeds the request", length)
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(s.body, payload)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "truncated message")
+	}
+
+	return proxyCodec{}.Unmarshal(payload, m)
+}
+
+func (s *webStream) writeHeader() {
+	if s.wroteHeader {
+		return
+	}
+
+	for key, vals := range s.header {
+		if isReservedGrpcHeader(key) {
+			continue
+		}
+
+		for _, val := range vals {
+			s.w.Header().Add(key, val)
+		}
+	}
+
+	s.w.Header().Set("Content-Type", s.contentType)
+	s.w.WriteHeader(http.StatusOK)
+	s.wroteHeader = true
+}
+
+func (s *webStream) writeFrame(flag byte, payload []byte) error {
+	frame := make([]byte, 5+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	copy(frame[5:], payload)
+
+	if s.text {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+
+	_, err := s.w.Write(frame)
+	if err != nil {
+		return err
+	}
+
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// finish ends the call with the trailer frame carrying the status of the call.
+func (s *webStream) finish(err error) {
+	defer s.cancel()
+
+	s.writeHeader()
+
+	stat := status.Convert(err)
+
+	var trailer bytes.Buffer
+	fmt.Fprintf(&trailer, "grpc-status: %d\r\n", stat.Code())
+	if stat.Message() != "" {
+		fmt.Fprintf(&trailer, "grpc-message: %s\r\n", url.PathEscape(stat.Message()))
+	}
+
+	for key, vals := range s.trailer {
+		if isReservedGrpcHeader(key) {
+			continue
+		}
+
+		for _, val := range vals {
+			fmt.Fprintf(&trailer, "%s: %s\r\n", strings.ToLower(key), val)
+		}
+	}
+
+	logger(s.writeFrame(grpcWebTrailerFlag, trailer.Bytes()))
+}
+
+func isReservedGrpcHeader(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, ":") || key == "content-type" || key == "grpc-status" || key == "grpc-message"
+}
+
+// decodeWebText decodes a grpc-web-text body, clients may send several padded base64 chunks.
+func decodeWebText(body []byte) ([]byte, error) {
+	body = bytes.Join(bytes.Fields(body), nil)
+
+	var res []byte
+	for len(body) > 0 {
+		end := len(body)
+		if i := bytes.IndexByte(body, '='); i >= 0 {
+			end = i
+			for end < len(body) && body[end] == '=' {
+				end++
+			}
+		}
+
+		chunk, err := base64.StdEncoding.DecodeString(string(body[:end]))
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, chunk...)
+		body = body[end:]
+	}
+
+	return res, nil
+}
+
+// grpcTimeout parses the grpc-timeout header such as 10S or 500m.
+func grpcTimeout(val string) (time.Duration, bool) {
+	if len(val) < 2 {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(val[:len(val)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+
+	unit, ok := units[val[len(val)-1]]
+	if !ok {
+		return 0, false
+	}
+
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/packets"
+)
+
+func TestWebStreamLimits(t *testing.T) {
+	os.Setenv(libs.AppGrpcWebMaxBody, "16")
+	defer os.Unsetenv(libs.AppGrpcWebMaxBody)
+
+	tests := []struct {
+		name string
+		body []byte
+		want codes.Code
+	}{
+		{"frame within the body", []byte{0, 0, 0, 0, 2, 0x0a, 0x00}, codes.OK},
+		{"frame longer than the body", []byte{0, 0xff, 0xff, 0xff, 0xff, 0x0a}, codes.ResourceExhausted},
+		{"body over the limit", bytes.Repeat([]byte{0}, 17), codes.ResourceExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, clevaCallMethod, bytes.NewReader(tt.body))
+			r.ContentLength = -1
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, chi.NewRouteContext()))
+
+			stream, err := newWebStream(httptest.NewRecorder(), r, grpcWebContentType)
+			if err == nil {
+				err = stream.RecvMsg(&packets.Request{})
+			}
+
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("code = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -7,11 +7,8 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"strings"
-	"time"
 
 	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
 	"github.com/uzzeet/uzzeet-gateway/service"
@@ -35,59 +32,14 @@ func (fwd chiForwarder) forward(w http.ResponseWriter, r *http.Request) {
 
 	composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
 
+	if composite.IsTranscoded() {
+		fwd.transcode(w, r, composite)
+		return
+	}
+
 	if composite.Connection == nil && composite.ServiceClient == nil {
-		basePath := composite.Endpoints()
-		path := r.RequestURI[strings.Index(r.RequestURI, basePath)+len(basePath):]
-		baseHttp := "http://" + composite.Url + path
-		if baseHttp != "" {
-			httpReq, err := http.NewRequest(r.Method, baseHttp, r.Body)
-			if err != nil {
-				fwd.notFound(composite.Key, w, r)
-				return
-			}
-			tr := &http.Transport{
-				MaxIdleConns:       100,
-				IdleConnTimeout:    30 * time.Second,
-				DisableCompression: true,
-			}
-
-			client := &http.Client{Transport: tr}
-			httpReq.Header = r.Header
-
-			resp, err := client.Do(httpReq)
-			if err != nil {
-				w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
-				w.WriteHeader(http.StatusInternalServerError)
-				logger(json.NewEncoder(w).Encode(models.Response{
-					Response:   http.StatusInternalServerError,
-					Error:      "Layanan tidak dapat diakses",
-					Controller: baseHttp,
-					Action:     r.Method,
-					Result:     "",
-				}))
-
-				return
-			}
-
-			defer resp.Body.Close()
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				log.Fatalln(err)
-			}
-
-			if resp.Header.Get("Content-Type") != models.ContentTypeValueJSON {
-				for k, v := range resp.Header {
-					w.Header().Set(k, v[0])
-				}
-				w.WriteHeader(resp.StatusCode)
-				w.Write(body)
-				return
-			}
-
-			fwd.responseFromHttp(composite.Key, w, body)
-
-			return
-		}
+		fwd.reverseProxy(w, r, composite)
+		return
 	}
 
 	ctx, req, err := transformRequestFromHttp(r)
@@ -134,7 +86,12 @@ func (fwd chiForwarder) forward(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	L.Infof("request %s has been served by %s", r.RequestURI, resp.Server)
+	if route, ok := r.Context().Value(models.RouteContextValueKey).(*service.RouteInfo); ok {
+		L.Infof("request %s (%s %s) has been served by %s", r.RequestURI, r.Method, route.Template, resp.Server)
+	} else {
+		L.Infof("request %s has been served by %s", r.RequestURI, resp.Server)
+	}
+
 	logger(transformResponseToHTTP(resp, header, w))
 }
 
@@ -152,18 +109,73 @@ func (fwd chiForwarder) notFound(serviceName string, w http.ResponseWriter, r *h
 	}))
 }
 
-func (fwd chiForwarder) responseFromHttp(serviceName string, w http.ResponseWriter, r []byte) {
+func (fwd chiForwarder) routeNotFound(serviceName string, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(http.StatusNotFound)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   http.StatusNotFound,
+		Error:      "Jalur tidak ditemukan",
+		Svcid:      serviceName,
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     "",
+	}))
+}
 
-	res := models.Response{}
-	if err := json.Unmarshal(r, &res); err != nil {
-		panic(err)
-	}
+func (fwd chiForwarder) methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed []string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   http.StatusMethodNotAllowed,
+		Error:      "Metode tidak diizinkan",
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     "",
+	}))
+}
 
-	w.WriteHeader(res.Response)
-	w.Write(r)
-	return
+func (fwd chiForwarder) badRequest(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(http.StatusBadRequest)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   http.StatusBadRequest,
+		Error:      message,
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     "",
+	}))
+}
+
+func (fwd chiForwarder) routes(w http.ResponseWriter, r *http.Request) {
+	result := make(map[string][]service.RouteInfo)
+	for _, each := range fwd.table().composites {
+		if !each.HasManifest() || each.Config().Preview != "" {
+			continue
+		}
+
+		endpoint := normalizeEndpoint(each.Endpoints())
+		if version := each.Version(); version != "" {
+			endpoint = normalizeEndpoint(version + endpoint)
+		}
 
+		if len(each.Hosts()) == 0 {
+			result[endpoint] = each.Manifest()
+		}
+
+		for _, host := range each.Hosts() {
+			result[normalizeHost(host)+endpoint] = each.Manifest()
+		}
+	}
+
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(http.StatusOK)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   http.StatusOK,
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     result,
+	}))
 }
 
 func (fwd chiForwarder) unauthorized(w http.ResponseWriter, message map[string]string, errs []models.Error) {
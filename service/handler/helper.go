@@ -22,12 +22,29 @@ func transformRequestFromHttp(r *http.Request) (context.Context, *packets.Reques
 		return nil, nil, fmt.Errorf("while reading request body: %v", err)
 	}
 
+	ctx, err := outgoingContext(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if r.URL.RawQuery != "" {
+		path = fmt.Sprintf("%s?%s", path, r.URL.RawQuery)
+	}
+
+	return ctx, &packets.Request{
+		Method: r.Method,
+		Path:   path,
+		Body:   body,
+	}, nil
+}
+
+func outgoingContext(r *http.Request) (context.Context, error) {
 	ctx := r.Context()
 	if ctx.Value(models.ClientInfoContextValueKey) != nil {
 		if clientInfo, ok := r.Context().Value(models.ClientInfoContextValueKey).(*models.ClientInfo); ok {
 			b, err := json.Marshal(clientInfo)
 			if err != nil {
-				return nil, nil, fmt.Errorf("while marshaling json: %v", err)
+				return nil, fmt.Errorf("while marshaling json: %v", err)
 			}
 
 			ctx = metadata.AppendToOutgoingContext(ctx, http.CanonicalHeaderKey(models.ClientInfoContextValueKey), string(b))
@@ -38,7 +55,7 @@ func transformRequestFromHttp(r *http.Request) (context.Context, *packets.Reques
 		if authInfo, ok := r.Context().Value(models.AuthorizationInfoContextValueKey).(*models.AuthorizationInfo); ok {
 			b, err := json.Marshal(authInfo)
 			if err != nil {
-				return nil, nil, fmt.Errorf("while marshaling json: %v", err)
+				return nil, fmt.Errorf("while marshaling json: %v", err)
 			}
 
 			ctx = metadata.AppendToOutgoingContext(ctx, http.CanonicalHeaderKey(models.AuthorizationInfoContextValueKey), string(b))
@@ -60,22 +77,14 @@ func transformRequestFromHttp(r *http.Request) (context.Context, *packets.Reques
 		case "x-remote-addr", "real-ip", "real-ip-proof":
 			continue
 
-		case "authorization":
+		case "authorization", models.PreviewHeaderKey:
 			ctx = metadata.AppendToOutgoingContext(ctx, http.CanonicalHeaderKey(key), vals[0])
 		}
 
 		ctx = metadata.AppendToOutgoingContext(ctx, http.CanonicalHeaderKey(fmt.Sprintf("bv-%s", key)), vals[0])
 	}
 
-	if r.URL.RawQuery != "" {
-		path = fmt.Sprintf("%s?%s", path, r.URL.RawQuery)
-	}
-
-	return ctx, &packets.Request{
-		Method: r.Method,
-		Path:   path,
-		Body:   body,
-	}, nil
+	return ctx, nil
 }
 
 func transformResponseToHTTP(resp *packets.Response, header metadata.MD, w http.ResponseWriter) error {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/asaskevich/govalidator"
 
+	"github.com/uzzeet/uzzeet-gateway/libs"
 	"github.com/uzzeet/uzzeet-gateway/libs/helper"
 	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
 )
@@ -42,6 +43,36 @@ func isPrivateAddress(address string) (bool, serror.SError) {
 	return false, nil
 }
 
+// isTrustedProxy reports whether the request comes from one of the proxies of APP_TRUSTED_PROXIES,
+// a comma separated list of addresses and CIDR blocks. Their X-Forwarded-* headers are kept.
+func isTrustedProxy(r *http.Request) bool {
+	remoteAddr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+
+	ip := net.ParseIP(remoteAddr)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range helper.CleanSpit(helper.Env(libs.AppTrustedProxies, ""), ",") {
+		if _, cidr, err := net.ParseCIDR(proxy); err == nil {
+			if cidr.Contains(ip) {
+				return true
+			}
+
+			continue
+		}
+
+		if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func RecoverRealIP(r *http.Request, skip int) (ip string, ok bool) {
 	const localhost = "127.0.0.1"
 	var ipTmp string
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+const (
+	// idempotencyLockTTL bounds how long a request in flight holds its key, it outlasts the
+	// timeout of the requests.
+	idempotencyLockTTL = 5 * time.Minute
+	maxIdempotencyKey  = 255
+)
+
+// UseIdempotencyStore replaces the store the outcomes of idempotent requests are kept in.
+func (fwd *chiForwarder) UseIdempotencyStore(store service.IdempotencyStore) {
+	fwd.outcomes.Store(&store)
+}
+
+func (fwd chiForwarder) idempotencyStore() service.IdempotencyStore {
+	return *fwd.outcomes.Load().(*service.IdempotencyStore)
+}
+
+// gatewayHeaders describe how the gateway served a response, they're dropped from the responses
+// kept so that replays don't pretend to be served the same way.
+var gatewayHeaders = []string{"X-Cache", "Age", "Idempotent-Replayed", "Retry-After",
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+	"X-Quota-Daily-Limit", "X-Quota-Daily-Remaining", "X-Quota-Monthly-Limit", "X-Quota-Monthly-Remaining"}
+
+// idempotentRecord is the outcome of a request, it's pending until the service answers.
+type idempotentRecord struct {
+	Hash    string      `json:"hash"`
+	Pending bool        `json:"pending,omitempty"`
+	Status  int         `json:"status,omitempty"`
+	Header  http.Header `json:"header,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+}
+
+// idempotency serves the retries of POST, PUT and DELETE requests carrying an Idempotency-Key with
+// the response of the first request, keys are scoped by user and path. Retries while the first
+// request is in flight are answered 409, reusing a key with another body 422. Server errors aren't
+// kept so that the request may be retried.
+func (fwd chiForwarder) idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(models.IdempotencyHeaderKey)
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			fwd.failure(w, r, http.StatusBadRequest, "Idempotency-Key terlalu panjang")
+			return
+		}
+
+		maxBody := helper.StringToInt(helper.Env(libs.AppIdempotencyMaxBody, "1048576"), 1048576)
+		if r.ContentLength > maxBody {
+			fwd.failure(w, r, http.StatusRequestEntityTooLarge, "Permintaan terlalu besar")
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		if err != nil {
+			fwd.failure(w, r, http.StatusBadRequest, "Gagal membaca permintaan")
+			return
+		}
+
+		if int64(len(body)) > maxBody {
+			fwd.failure(w, r, http.StatusRequestEntityTooLarge, "Permintaan terlalu besar")
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(body)
+		record := idempotentRecord{Hash: hex.EncodeToString(hash[:]), Pending: true}
+		scope := idempotencyScope(r, key)
+
+		store := fwd.idempotencyStore()
+		pending, _ := json.Marshal(record)
+		existing, ok, err := store.Reserve(scope, pending, idempotencyLockTTL)
+		if err != nil {
+			L.Err(serror.NewFromErrorc(err, "while reserving idempotency key"))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !ok {
+			fwd.replay(w, r, existing, record.Hash)
+			return
+		}
+
+		completed := false
+		defer func() {
+			if !completed {
+				logger(store.Release(scope))
+			}
+		}()
+
+		recorder := &teeRecorder{ResponseWriter: w, header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError || recorder.overflow {
+			return
+		}
+
+		header := recorder.header.Clone()
+		for _, key := range gatewayHeaders {
+			header.Del(key)
+		}
+
+		record = idempotentRecord{Hash: record.Hash, Status: recorder.status, Header: header, Body: recorder.body.Bytes()}
+		b, err := json.Marshal(record)
+		if err != nil {
+			L.Err(serror.NewFromErrorc(err, "while encoding idempotent response"))
+			return
+		}
+
+		ttl := time.Duration(helper.StringToInt(helper.Env(libs.AppIdempotencyTTL, "86400"), 86400)) * time.Second
+		err = store.Complete(scope, b, ttl)
+		if err != nil {
+			L.Err(serror.NewFromErrorc(err, "while storing idempotent response"))
+			return
+		}
+
+		completed = true
+	})
+}
+
+// replay answers a retry with the outcome of the request which took the key first.
+func (fwd chiForwarder) replay(w http.ResponseWriter, r *http.Request, existing []byte, hash string) {
+	var record idempotentRecord
+
+	err := json.Unmarshal(existing, &record)
+	if err != nil {
+		L.Err(serror.NewFromErrorc(err, "while decoding idempotent response"))
+		fwd.failure(w, r, http.StatusInternalServerError, "Kesalahan pada server")
+		return
+	}
+
+	switch {
+	case record.Hash != hash:
+		fwd.failure(w, r, http.StatusUnprocessableEntity, "Idempotency-Key sudah dipakai untuk permintaan lain")
+
+	case record.Pending:
+		fwd.failure(w, r, http.StatusConflict, "Permintaan yang sama sedang diproses")
+
+	default:
+		for key, vals := range record.Header {
+			w.Header()[key] = vals
+		}
+
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.Header().Set("Content-Length", strconv.Itoa(len(record.Body)))
+		w.WriteHeader(record.Status)
+
+		_, err := w.Write(record.Body)
+		logger(err)
+	}
+}
+
+// idempotencyScope binds the key to the user, or the IP, client ID and token of anonymous clients,
+// and to the method and path of the request. It's hashed to bound its length and keep the token
+// out of the store.
+func idempotencyScope(r *http.Request, key string) string {
+	identity := ""
+	if authInfo, ok := r.Context().Value(models.AuthorizationInfoContextValueKey).(*models.AuthorizationInfo); ok && authInfo != nil && authInfo.UserID != "" {
+		identity = "user=" + authInfo.UserID
+	} else {
+		ip, _ := RecoverRealIP(r, int(helper.StringToInt(helper.Env("DEFAULT_SKIP_FORWARDED_FOR", "0"), 0)))
+		client := ""
+		if clientInfo, ok := r.Context().Value(models.ClientInfoContextValueKey).(*models.ClientInfo); ok && clientInfo != nil {
+			client = clientInfo.ClientID
+		}
+
+		identity = "ip=" + ip + "\nclient=" + client + "\ntoken=" + r.Header.Get(models.AuthorizationHeaderKey)
+	}
+
+	scope := sha256.Sum256([]byte(identity + "\n" + r.Method + "\n" + r.URL.Path + "\n" + key))
+	return hex.EncodeToString(scope[:])
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/models"
+)
+
+func TestIdempotencyReplay(t *testing.T) {
+	type call struct {
+		method   string
+		body     string
+		key      string
+		status   int
+		served   bool
+		replayed bool
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		calls  []call
+	}{
+		{"replayed", http.StatusCreated, []call{
+			{http.MethodPost, "one", "k1", http.StatusCreated, true, false},
+			{http.MethodPost, "one", "k1", http.StatusCreated, false, true},
+		}},
+		{"key reused with another body", http.StatusCreated, []call{
+			{http.MethodPost, "one", "k1", http.StatusCreated, true, false},
+			{http.MethodPost, "two", "k1", http.StatusUnprocessableEntity, false, false},
+		}},
+		{"key scoped by method", http.StatusCreated, []call{
+			{http.MethodPost, "one", "k1", http.StatusCreated, true, false},
+			{http.MethodPut, "one", "k1", http.StatusCreated, true, false},
+		}},
+		{"requests without key", http.StatusCreated, []call{
+			{http.MethodPost, "one", "", http.StatusCreated, true, false},
+			{http.MethodPost, "one", "", http.StatusCreated, true, false},
+		}},
+		{"server errors aren't kept", http.StatusBadGateway, []call{
+			{http.MethodPost, "one", "k1", http.StatusBadGateway, true, false},
+			{http.MethodPost, "one", "k1", http.StatusBadGateway, true, false},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fwd := newIdempotentForwarder()
+
+			var served int32
+			handler := fwd.idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&served, 1)
+				w.WriteHeader(tt.status)
+			}))
+
+			for i, c := range tt.calls {
+				before := atomic.LoadInt32(&served)
+
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, newIdempotentRequest(c.method, c.body, c.key))
+
+				if w.Code != c.status {
+					t.Errorf("call %d answered %d, want %d", i, w.Code, c.status)
+				}
+
+				if got := atomic.LoadInt32(&served) > before; got != c.served {
+					t.Errorf("call %d reached the service = %v, want %v", i, got, c.served)
+				}
+
+				if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != c.replayed {
+					t.Errorf("call %d replayed = %v, want %v", i, replayed, c.replayed)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	fwd := newIdempotentForwarder()
+
+	var retry *httptest.ResponseRecorder
+	var handler http.Handler
+	handler = fwd.idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retry == nil {
+			// the retry arrives while the first request is still in flight.
+			retry = httptest.NewRecorder()
+			handler.ServeHTTP(retry, newIdempotentRequest(http.MethodPost, "one", "k1"))
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newIdempotentRequest(http.MethodPost, "one", "k1"))
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("first request answered %d, want %d", w.Code, http.StatusCreated)
+	}
+
+	if retry.Code != http.StatusConflict {
+		t.Errorf("retry in flight answered %d, want %d", retry.Code, http.StatusConflict)
+	}
+}
+
+func TestIdempotencyLimits(t *testing.T) {
+	os.Setenv(libs.AppIdempotencyMaxBody, "4")
+	defer os.Unsetenv(libs.AppIdempotencyMaxBody)
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"within the limit", "abcd", false, http.StatusCreated},
+		{"over the limit", "abcde", false, http.StatusRequestEntityTooLarge},
+		{"unknown length over the limit", "abcde", true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newIdempotentForwarder().idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			}))
+
+			r := newIdempotentRequest(http.MethodPost, tt.body, "k1")
+			if tt.chunked {
+				r.Body = ioutil.NopCloser(strings.NewReader(tt.body))
+				r.ContentLength = -1
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("request answered %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	scope := func(token string, client string, authInfo *models.AuthorizationInfo) string {
+		r := newIdempotentRequest(http.MethodPost, "", "k1")
+		if token != "" {
+			r.Header.Set(models.AuthorizationHeaderKey, token)
+		}
+
+		ctx := context.WithValue(r.Context(), models.ClientInfoContextValueKey, &models.ClientInfo{ClientID: client})
+		if authInfo != nil {
+			ctx = context.WithValue(ctx, models.AuthorizationInfoContextValueKey, authInfo)
+		}
+
+		return idempotencyScope(r.WithContext(ctx), "k1")
+	}
+
+	anonymous := scope("", "", nil)
+	tests := []struct {
+		name  string
+		scope string
+		same  bool
+	}{
+		{"same anonymous client", scope("", "", nil), true},
+		{"another token", scope("Bearer t1", "", nil), false},
+		{"another client", scope("", "c1", nil), false},
+		{"user", scope("", "", &models.AuthorizationInfo{UserID: "u1"}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := tt.scope == anonymous; same != tt.same {
+				t.Errorf("scope shared with the anonymous client = %v, want %v", same, tt.same)
+			}
+		})
+	}
+
+	if scope("Bearer t1", "", &models.AuthorizationInfo{UserID: "u1"}) != scope("Bearer t2", "c1", &models.AuthorizationInfo{UserID: "u1"}) {
+		t.Errorf("scopes of the same user differ")
+	}
+}
+
+func newIdempotentForwarder() *chiForwarder {
+	return NewChiForwarder(nil, nil, nil, chi.NewMux()).(*chiForwarder)
+}
+
+func newIdempotentRequest(method string, body string, key string) *http.Request {
+	r := httptest.NewRequest(method, "/devices/1", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(models.IdempotencyHeaderKey, key)
+	}
+
+	return r
+}
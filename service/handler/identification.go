@@ -9,6 +9,7 @@ import (
 	"github.com/uzzeet/uzzeet-gateway/controller/auth"
 	"github.com/uzzeet/uzzeet-gateway/models"
 	"github.com/uzzeet/uzzeet-gateway/service"
+	"go.elastic.co/apm"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -36,23 +37,31 @@ func (fwd chiForwarder) agentIdentification(next http.Handler) http.Handler {
 
 func (fwd chiForwarder) serviceIdentification(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var composite *service.Composite
-
-		serviceName := chi.URLParam(r, "service")
-		for _, each := range fwd.composite {
-			if each.Endpoints() == fmt.Sprintf("/%s", serviceName) {
-				composite = each
+		requestPath := "/" + chi.URLParam(r, "*")
+		version := r.Header.Get(models.AcceptVersionHeaderKey)
+		preview := r.Header.Get(models.PreviewHeaderKey)
 
+		// the composite is tracked until the request is served, one replaced meanwhile is looked up
+		// again in the table replacing it.
+		var (
+			table     *routingTable
+			composite *service.Composite
+			path      string
+			release   func()
+		)
+		for acquired := false; !acquired; {
+			table = fwd.table()
+			composite, path = table.lookup(r.Host, requestPath, version, preview)
+			if composite == nil {
 				break
 			}
+
+			release, acquired = composite.Acquire()
 		}
 
 		if composite != nil {
-			basePath := composite.Endpoints()
-			path := r.URL.Path[strings.Index(r.URL.Path, basePath)+len(basePath):]
-			if path == "" {
-				path = "/"
-			}
+			defer release()
+			path = composite.Rewrite(path)
 
 			r = r.WithContext(context.WithValue(r.Context(), models.ServiceContextValueKey, composite))
 			r = r.WithContext(context.WithValue(r.Context(), models.PathContextValueKey, path))
@@ -62,75 +71,200 @@ func (fwd chiForwarder) serviceIdentification(next http.Handler) http.Handler {
 			return
 		}
 
-		fwd.notFound(serviceName, w, r)
+		// the service exists, only not in the requested version.
+		if version != "" {
+			if other, _ := table.lookup(r.Host, requestPath, "", preview); other != nil {
+				fwd.failure(w, r, http.StatusNotAcceptable, fmt.Sprintf("Versi %s tidak tersedia", version))
+				return
+			}
+		}
+
+		fwd.notFound(strings.Split(strings.Trim(requestPath, "/"), "/")[0], w, r)
 	})
 }
 
-func (fwd chiForwarder) authorization(next http.Handler) http.Handler {
+// trimEndpoint removes everything up to the base path of the composite, the base path must end on
+// a segment boundary so that /fleet doesn't match /fleetapi.
+func trimEndpoint(path string, basePath string) string {
+	basePath = normalizeEndpoint(basePath)
+	if basePath == "/" {
+		return path
+	}
+
+	offset := 0
+	for {
+		i := strings.Index(path[offset:], basePath)
+		if i < 0 {
+			return path
+		}
+
+		end := offset + i + len(basePath)
+		if end == len(path) {
+			return "/"
+		}
+
+		if path[end] == '/' {
+			return path[end:]
+		}
+
+		offset = end
+	}
+}
+
+func (fwd chiForwarder) routeValidation(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
-		path := r.Context().Value(models.PathContextValueKey).(string)
-		if needProtection, isStrict, isPrivate := composite.IsNeedProtection(r.Method, path); needProtection {
-			authService := fwd.authService
+		if !composite.HasManifest() {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-			switch {
-			case isStrict:
-				authService = fwd.strictAuthService
+		path := r.Context().Value(models.PathContextValueKey).(string)
+		if isMalformedPath(path) {
+			fwd.badRequest(w, r, "Jalur tidak valid")
+			return
+		}
 
-			case isPrivate:
-				authService = fwd.privateAuthService
+		route, allowed := composite.Route(r.Method, path)
+		if route == nil {
+			if len(allowed) > 0 {
+				fwd.methodNotAllowed(w, r, allowed)
+				return
 			}
 
-			body, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				err := fmt.Errorf("while reading body: %v", err)
-				logger(json.NewEncoder(w).Encode(models.Response{
-					Response:   http.StatusInternalServerError,
-					Error:      err.Error(),
-					Controller: r.RequestURI,
-					Action:     r.Method,
-				}))
+			fwd.routeNotFound(composite.Keys(), w, r)
+			return
+		}
 
-				return
-			}
+		if tx := apm.TransactionFromContext(r.Context()); tx != nil {
+			tx.Name = fmt.Sprintf("%s %s%s", r.Method, composite.Endpoints(), route.Template)
+		}
 
-			timestamp, _ := time.Parse(models.TimestampFormat, r.Header.Get(models.TimestampHeaderKey))
-			authInfo, err := authService.Authorize(models.Request{
-				Method:      r.Method,
-				CompositeID: models.CompositeID(r.Header.Get(models.ClientIDHeaderKey)),
-				URL:         r.URL,
-				Token:       r.Header.Get(models.AuthorizationHeaderKey),
-				Body:        body,
-				Timestamp:   timestamp,
-				Signature:   r.Header.Get(models.SignatureHeaderKey),
-			})
-			if err != nil {
-				switch erx := err.(type) {
-				default:
-					w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
-					logger(json.NewEncoder(w).Encode(models.Response{
-						Response:   http.StatusInternalServerError,
-						Error:      err.Error(),
-						Controller: r.RequestURI,
-						Action:     r.Method,
-					}))
-
-				case auth.AuthorizationError:
-					authErr := erx
-					fwd.unauthorized(w, authErr.Message(), []models.Error{
-						{
-							InternalMessage: authErr.Error(),
-						},
-					})
-				}
+		r = r.WithContext(context.WithValue(r.Context(), models.RouteContextValueKey, route))
+		next.ServeHTTP(w, r)
+	})
+}
 
+func isMalformedPath(path string) bool {
+	if !strings.HasPrefix(path, "/") || strings.Contains(path, "//") {
+		return true
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+
+	for _, c := range path {
+		if c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (fwd chiForwarder) authorization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
+		path := r.Context().Value(models.PathContextValueKey).(string)
+		if authService, ok := fwd.authServiceOf(fwd.authMethodOf(composite, r.Method, path)); ok {
+			r, ok = fwd.authorize(w, r, authService)
+			if !ok {
 				return
 			}
-
-			r = r.WithContext(context.WithValue(r.Context(), models.AuthorizationInfoContextValueKey, authInfo))
-			r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authMethodOf returns the auth method protecting the route, protect, strict or private, it's
+// empty for public routes.
+func (fwd chiForwarder) authMethodOf(composite *service.Composite, method string, path string) string {
+	needProtection, isStrict, isPrivate := composite.IsNeedProtection(method, path)
+	switch {
+	case !needProtection:
+		return ""
+
+	case isStrict:
+		return "strict"
+
+	case isPrivate:
+		return "private"
+	}
+
+	return "protect"
+}
+
+// authorize authorizes the request with the auth service, failures are answered and reported by
+// returning false.
+func (fwd chiForwarder) authorize(w http.ResponseWriter, r *http.Request, authService auth.Service) (*http.Request, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		err := fmt.Errorf("while reading body: %v", err)
+		logger(json.NewEncoder(w).Encode(models.Response{
+			Response:   http.StatusInternalServerError,
+			Error:      err.Error(),
+			Controller: r.RequestURI,
+			Action:     r.Method,
+		}))
+
+		return r, false
+	}
+
+	timestamp, _ := time.Parse(models.TimestampFormat, r.Header.Get(models.TimestampHeaderKey))
+	authInfo, err := authService.Authorize(models.Request{
+		Method:      r.Method,
+		CompositeID: models.CompositeID(r.Header.Get(models.ClientIDHeaderKey)),
+		URL:         r.URL,
+		Token:       r.Header.Get(models.AuthorizationHeaderKey),
+		Body:        body,
+		Timestamp:   timestamp,
+		Signature:   r.Header.Get(models.SignatureHeaderKey),
+	})
+	if err != nil {
+		switch erx := err.(type) {
+		default:
+			w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+			logger(json.NewEncoder(w).Encode(models.Response{
+				Response:   http.StatusInternalServerError,
+				Error:      err.Error(),
+				Controller: r.RequestURI,
+				Action:     r.Method,
+			}))
+
+		case auth.AuthorizationError:
+			authErr := erx
+			fwd.unauthorized(w, authErr.Message(), []models.Error{
+				{
+					InternalMessage: authErr.Error(),
+				},
+			})
+		}
+
+		return r, false
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), models.AuthorizationInfoContextValueKey, authInfo))
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	// the client ID is only trusted once its signature is verified.
+	if verifiesSignature(authService) {
+		clientInfo := &models.ClientInfo{}
+		if current, ok := r.Context().Value(models.ClientInfoContextValueKey).(*models.ClientInfo); ok && current != nil {
+			*clientInfo = *current
+		}
+		clientInfo.ClientID = r.Header.Get(models.ClientIDHeaderKey)
+
+		r = r.WithContext(context.WithValue(r.Context(), models.ClientInfoContextValueKey, clientInfo))
+	}
+
+	return r, true
+}
+
+func verifiesSignature(authService auth.Service) bool {
+	verifier, ok := authService.(auth.SignatureVerifier)
+	return ok && verifier.VerifiesSignature()
+}
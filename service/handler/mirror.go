@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// mirrorLimit is the largest request body duplicated to a shadow, bigger requests aren't mirrored.
+const mirrorLimit = 1 << 20
+
+// trafficMirror duplicates a sample of the requests of a composite to its shadow once the request
+// has been authorized, the shadow is called in the background and its response is discarded. Only
+// the difference of status and latency with the primary is recorded.
+func (fwd chiForwarder) trafficMirror(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
+
+		shadow, mirror, ok := fwd.table().shadowOf(composite)
+		if !ok || !mirror.Mirrors(r.Method) || rand.Intn(100) >= mirror.Sample || isUpgradeRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, mirrorLimit+1))
+		if err != nil {
+			fwd.badRequest(w, r, "Gagal membaca permintaan")
+			return
+		}
+
+		if len(body) > mirrorLimit {
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		// the copy is prepared before the primary runs, the request must not be read afterwards.
+		shadowReq := mirrorRequest(r, composite, shadow, body)
+
+		select {
+		case fwd.mirrors <- struct{}{}:
+
+		default:
+			L.Warnf("too many mirrored requests in-flight, request %s isn't mirrored to %s", r.RequestURI, shadow.Keys())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		primary := make(chan mirrorResult, 1)
+		go fwd.mirror(shadowReq, composite, shadow, primary)
+
+		// the result is sent even when the primary panics, the mirror waits for it.
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		defer func() {
+			primary <- mirrorResult{recorder.status, time.Since(start)}
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+type mirrorResult struct {
+	status  int
+	latency time.Duration
+}
+
+func (fwd chiForwarder) mirror(r *http.Request, composite *service.Composite, shadow *service.Composite, primary <-chan mirrorResult) {
+	defer func() { <-fwd.mirrors }()
+
+	release, ok := shadow.Acquire()
+	if !ok {
+		return
+	}
+	defer release()
+
+	timeout := time.Duration(helper.StringToInt(helper.Env(libs.AppMirrorTimeout, "30"), 30)) * time.Second
+	ctx, cancel := context.WithTimeout(detachedContext{r.Context()}, timeout)
+	defer cancel()
+
+	recorder := &discardRecorder{header: http.Header{}, status: http.StatusOK}
+	start := time.Now()
+	fwd.forward(recorder, r.WithContext(ctx))
+	res := mirrorResult{recorder.status, time.Since(start)}
+
+	main := <-primary
+	if main.status != res.status {
+		L.Warnf("mirror of %s %s differs: %s answered %d in %s, shadow %s answered %d in %s",
+			r.Method, r.RequestURI, composite.Keys(), main.status, main.latency, shadow.Keys(), res.status, res.latency)
+		return
+	}
+
+	L.Infof("mirror of %s %s: %s answered %d in %s, shadow %s in %s (%+dms)",
+		r.Method, r.RequestURI, composite.Keys(), main.status, main.latency, shadow.Keys(), res.latency,
+		(res.latency - main.latency).Milliseconds())
+}
+
+// mirrorRequest copies the request for the shadow, its path is mapped onto the endpoint of the
+// shadow so that it goes through the shadow's own rewrites.
+func mirrorRequest(r *http.Request, composite *service.Composite, shadow *service.Composite, body []byte) *http.Request {
+	rest := trimEndpoint(r.URL.EscapedPath(), composite.Endpoints())
+	path := rest
+	if unescaped, err := url.PathUnescape(rest); err == nil {
+		path = unescaped
+	}
+
+	ctx := context.WithValue(r.Context(), models.ServiceContextValueKey, shadow)
+	ctx = context.WithValue(ctx, models.PathContextValueKey, shadow.Rewrite(path))
+	if route, _ := shadow.Route(r.Method, path); route != nil {
+		ctx = context.WithValue(ctx, models.RouteContextValueKey, route)
+	}
+
+	req := r.Clone(ctx)
+	req.URL.RawPath = strings.TrimRight(normalizeEndpoint(shadow.Endpoints()), "/") + rest
+	req.URL.Path = strings.TrimRight(normalizeEndpoint(shadow.Endpoints()), "/") + path
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	return req
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	return strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// detachedContext keeps the values of the request, authorization info included, without being
+// canceled along with it.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// discardRecorder answers the shadow, only its status is kept.
+type discardRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+}
+
+func (w *discardRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *discardRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+}
+
+func (w *discardRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return len(b), nil
+}
+
+func (w *discardRecorder) Flush() {}
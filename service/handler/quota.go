@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
+	"github.com/uzzeet/uzzeet-gateway/libs/utils/uttime"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// Quota enforces the quota, it takes effect for the next requests.
+func (fwd *chiForwarder) Quota(quota service.Quota) error {
+	err := quota.Validate()
+	if err != nil {
+		return err
+	}
+
+	fwd.mutex.Lock()
+	fwd.snapshot.Store(fwd.table().withQuota(quota))
+	fwd.mutex.Unlock()
+
+	if quota.IsActive() {
+		L.Infof("quota of %s is %d request(s) a day and %d a month", quota.Subject(), quota.Daily, quota.Monthly)
+	} else {
+		L.Infof("quota of %s is lifted", quota.Subject())
+	}
+
+	return nil
+}
+
+// UseUsageMeter replaces the meter the requests are counted with.
+func (fwd *chiForwarder) UseUsageMeter(meter service.UsageMeter) {
+	fwd.meter.Store(&meter)
+}
+
+func (fwd chiForwarder) usageMeter() service.UsageMeter {
+	return *fwd.meter.Load().(*service.UsageMeter)
+}
+
+// usagePeriod returns the day and month of the time in APP_TIMEZONE, along with the time left
+// until the next day.
+func usagePeriod(now time.Time) (string, string, time.Duration) {
+	now, _ = uttime.WithTimezone(now, helper.Env(libs.AppTimezone, "UTC"))
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+
+	return now.Format("2006-01-02"), now.Format("2006-01"), tomorrow.Sub(now)
+}
+
+// usageQuota meters the requests of the app and organization of the token against their quotas.
+// Requests over the daily quota are answered 429 until the next day, those over the monthly quota
+// 403. Requests are let through when the meter fails.
+func (fwd chiForwarder) usageQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authInfo, ok := r.Context().Value(models.AuthorizationInfoContextValueKey).(*models.AuthorizationInfo)
+		if !ok || authInfo == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		quotas, usages, code := fwd.meterUsage(authInfo, r.RequestURI)
+		setQuotaHeaders(w.Header(), quotas, usages)
+
+		switch code {
+		case http.StatusForbidden:
+			fwd.failure(w, r, code, "Kuota bulanan habis")
+
+		case http.StatusTooManyRequests:
+			_, _, left := usagePeriod(time.Now())
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(left)))
+			fwd.failure(w, r, code, "Kuota harian habis")
+
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// meterUsage counts the call against the quotas of the app and organization of the token, it
+// returns the quotas and their usage along with the status answering a call over quota, zero when
+// the call is allowed. Calls are allowed when the meter fails.
+func (fwd chiForwarder) meterUsage(authInfo *models.AuthorizationInfo, uri string) ([]service.Quota, []service.Usage, int) {
+	quotas := []service.Quota{}
+	for _, subject := range []string{service.QuotaByApp + ":" + authInfo.AppId, service.QuotaByOrganization + ":" + authInfo.OrganizationId} {
+		if quota, ok := fwd.table().quotas[subject]; ok {
+			quotas = append(quotas, quota)
+		}
+	}
+
+	if len(quotas) == 0 {
+		return nil, nil, 0
+	}
+
+	day, month, _ := usagePeriod(time.Now())
+	usages, ok, err := fwd.usageMeter().Consume(quotas, day, month)
+	if err != nil {
+		L.Err(serror.NewFromErrorc(err, "while metering usage"))
+		return nil, nil, 0
+	}
+
+	if ok {
+		return quotas, usages, 0
+	}
+
+	code := http.StatusTooManyRequests
+	for i, quota := range quotas {
+		if quota.IsExceeded(usages[i]) {
+			L.Warnf("call %s exceeds quota of %s", uri, quota.Subject())
+			if quota.Monthly > 0 && usages[i].Monthly >= quota.Monthly {
+				code = http.StatusForbidden
+			}
+		}
+	}
+
+	return quotas, usages, code
+}
+
+// setQuotaHeaders describes the daily and monthly quotas with the least requests remaining, the
+// app and its organization may both be bounded.
+func setQuotaHeaders(header http.Header, quotas []service.Quota, usages []service.Usage) {
+	daily, monthly := -1, -1
+	for i, quota := range quotas {
+		if quota.Daily > 0 && (daily < 0 || remaining(quota.Daily, usages[i].Daily) < remaining(quotas[daily].Daily, usages[daily].Daily)) {
+			daily = i
+		}
+
+		if quota.Monthly > 0 && (monthly < 0 || remaining(quota.Monthly, usages[i].Monthly) < remaining(quotas[monthly].Monthly, usages[monthly].Monthly)) {
+			monthly = i
+		}
+	}
+
+	if daily >= 0 {
+		header.Set("X-Quota-Daily-Limit", strconv.FormatInt(quotas[daily].Daily, 10))
+		header.Set("X-Quota-Daily-Remaining", strconv.FormatInt(remaining(quotas[daily].Daily, usages[daily].Daily), 10))
+	}
+
+	if monthly >= 0 {
+		header.Set("X-Quota-Monthly-Limit", strconv.FormatInt(quotas[monthly].Monthly, 10))
+		header.Set("X-Quota-Monthly-Remaining", strconv.FormatInt(remaining(quotas[monthly].Monthly, usages[monthly].Monthly), 10))
+	}
+}
+
+func remaining(limit int64, used int64) int64 {
+	if used >= limit {
+		return 0
+	}
+
+	return limit - used
+}
+
+// usage answers the usage of the subject along with its quota, the day and month default to the
+// current ones and may be picked with the day and month query parameters.
+func (fwd chiForwarder) usage(w http.ResponseWriter, r *http.Request) {
+	subject, day, month, ok := fwd.usageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := fwd.usageMeter().Usage(subject, day, month)
+	if err != nil {
+		L.Err(serror.NewFromErrorc(err, "while reading usage"))
+		fwd.failure(w, r, http.StatusInternalServerError, "Gagal membaca penggunaan")
+		return
+	}
+
+	result := map[string]interface{}{"usage": usage}
+	if quota, ok := fwd.table().quotas[subject]; ok {
+		result["quota"] = quota
+	}
+
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(http.StatusOK)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   http.StatusOK,
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     result,
+	}))
+}
+
+// resetUsage resets the usage of the subject for the day and month, as picked by usage.
+func (fwd chiForwarder) resetUsage(w http.ResponseWriter, r *http.Request) {
+	subject, day, month, ok := fwd.usageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := fwd.usageMeter().ResetUsage(subject, day, month)
+	if err != nil {
+		L.Err(serror.NewFromErrorc(err, "while resetting usage"))
+		fwd.failure(w, r, http.StatusInternalServerError, "Gagal mengatur ulang penggunaan")
+		return
+	}
+
+	L.Infof("usage of %s on %s and %s is reset", subject, day, month)
+
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(http.StatusOK)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   http.StatusOK,
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     service.Usage{Subject: subject, Day: day, Month: month},
+	}))
+}
+
+// usageRequest returns the subject, day and month of an administration request, invalid ones are
+// answered 400.
+func (fwd chiForwarder) usageRequest(w http.ResponseWriter, r *http.Request) (string, string, string, bool) {
+	quota := service.Quota{By: chi.URLParam(r, "by"), ID: chi.URLParam(r, "id")}
+	if quota.Validate() != nil {
+		fwd.failure(w, r, http.StatusBadRequest, "Subjek tidak valid")
+		return "", "", "", false
+	}
+
+	day, month, _ := usagePeriod(time.Now())
+	if val := r.URL.Query().Get("day"); val != "" {
+		if _, err := time.Parse("2006-01-02", val); err != nil {
+			fwd.failure(w, r, http.StatusBadRequest, "Tanggal tidak valid")
+			return "", "", "", false
+		}
+
+		day = val
+	}
+
+	if val := r.URL.Query().Get("month"); val != "" {
+		if _, err := time.Parse("2006-01", val); err != nil {
+			fwd.failure(w, r, http.StatusBadRequest, "Bulan tidak valid")
+			return "", "", "", false
+		}
+
+		month = val
+	}
+
+	return quota.Subject(), day, month, true
+}
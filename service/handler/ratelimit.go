@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// UseRateLimiter replaces the limiter the requests are counted with.
+func (fwd *chiForwarder) UseRateLimiter(limiter service.RateLimiter) {
+	fwd.limiter.Store(&limiter)
+}
+
+func (fwd chiForwarder) rateLimiter() service.RateLimiter {
+	return *fwd.limiter.Load().(*service.RateLimiter)
+}
+
+// anonymousRateLimit counts the request against the limits by IP of its route before it's
+// authorized, so that requests failing authorization use them up as well.
+func (fwd chiForwarder) anonymousRateLimit(next http.Handler) http.Handler {
+	return fwd.limitRequests(next, true)
+}
+
+// rateLimit counts the request against the other limits of its route, it runs after authorization
+// so that clients can be identified by their user or organization.
+func (fwd chiForwarder) rateLimit(next http.Handler) http.Handler {
+	return fwd.limitRequests(next, false)
+}
+
+// limitRequests counts the requests against the limits by IP of their route, or the others. The
+// RateLimit-* headers describe the limit closest to be exhausted. Requests are let through when
+// the limiter fails.
+func (fwd chiForwarder) limitRequests(next http.Handler, anonymous bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		composite := r.Context().Value(models.ServiceContextValueKey).(*service.Composite)
+		path := r.Context().Value(models.PathContextValueKey).(string)
+
+		authInfo, _ := r.Context().Value(models.AuthorizationInfoContextValueKey).(*models.AuthorizationInfo)
+		client := ""
+		if clientInfo, ok := r.Context().Value(models.ClientInfoContextValueKey).(*models.ClientInfo); ok && clientInfo != nil {
+			client = clientInfo.ClientID
+		}
+		ip, _ := RecoverRealIP(r, int(helper.StringToInt(helper.Env("DEFAULT_SKIP_FORWARDED_FOR", "0"), 0)))
+
+		res, ok := fwd.limitRate(composite, r.Method, path, anonymous, func(limit service.RateLimit) string {
+			return rateLimitIdentity(limit, ip, client, authInfo)
+		})
+		if res != nil {
+			setRateLimitHeaders(w.Header(), *res)
+		}
+
+		if !ok {
+			L.Warnf("request %s exceeds rate limits of service %s", r.RequestURI, composite.Keys())
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			fwd.failure(w, r, http.StatusTooManyRequests, "Terlalu banyak permintaan")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitRate counts the call against the limits by IP of the route when anonymous, against the
+// others otherwise. It returns whether the call is allowed along with the result to describe: the
+// limit closest to be exhausted or, once rejected, the limit to be retried last. There's no result
+// when no limit applies or the limiter fails.
+func (fwd chiForwarder) limitRate(composite *service.Composite, method string, path string, anonymous bool, identify func(service.RateLimit) string) (*service.RateLimitResult, bool) {
+	limits := []service.RateLimit{}
+	for _, limit := range composite.RateLimits(method, path) {
+		if (limit.By == service.RateLimitByIP) == anonymous {
+			limits = append(limits, limit)
+		}
+	}
+
+	if len(limits) == 0 {
+		return nil, true
+	}
+
+	keys := make([]string, len(limits))
+	for i, limit := range limits {
+		keys[i] = composite.Keys() + ":" + limit.Name + ":" + identify(limit)
+	}
+
+	results, err := fwd.rateLimiter().Allow(keys, limits)
+	if err != nil {
+		L.Err(serror.NewFromErrorc(err, "while applying rate limits"))
+		return nil, true
+	}
+
+	var res *service.RateLimitResult
+	allowed := true
+	for i := range results {
+		switch each := &results[i]; {
+		case !each.Allowed:
+			if allowed || each.RetryAfter > res.RetryAfter {
+				res = each
+			}
+			allowed = false
+
+		case allowed && (res == nil || each.Remaining < res.Remaining):
+			res = each
+		}
+	}
+
+	return res, allowed
+}
+
+// rateLimitIdentity identifies the client the limit is counted for, clients without the identity
+// the limit needs are identified by their IP. The client ID must come from a verified signature,
+// it's empty otherwise.
+func rateLimitIdentity(limit service.RateLimit, ip string, client string, authInfo *models.AuthorizationInfo) string {
+	switch {
+	case limit.By == service.RateLimitByClient && client != "":
+		return "client=" + client
+
+	case limit.By == service.RateLimitByUser && authInfo != nil && authInfo.UserID != "":
+		return "user=" + authInfo.UserID
+
+	case limit.By == service.RateLimitByOrganization && authInfo != nil && authInfo.OrganizationId != "":
+		return "org=" + authInfo.OrganizationId
+	}
+
+	return "ip=" + ip
+}
+
+// setRateLimitHeaders describes the result, unless the headers already describe a limit closer to
+// be exhausted.
+func setRateLimitHeaders(header http.Header, res service.RateLimitResult) {
+	if remaining, err := strconv.Atoi(header.Get("RateLimit-Remaining")); err == nil && remaining < res.Remaining {
+		return
+	}
+
+	header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/uzzeet/uzzeet-gateway/controller/auth"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+func TestAnonymousRateLimit(t *testing.T) {
+	mux := chi.NewMux()
+	// requests without credentials fail authorization.
+	authService := auth.NewService("protect", "secret", nil, false)
+	fwd := NewChiForwarder(authService, authService, authService, mux).(*chiForwarder)
+	fwd.UseRateLimiter(service.NewMemoryRateLimiter())
+	fwd.Mount(newTestComposite(t, `"key":"devices","gateway_endpoint":"/devices",
+		"routes":[{"method":"get","path":"/.*","auth":"protect"}],
+		"rate_limits":[{"by":"ip","limit":2,"window":60}]`))
+
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for i, code := range want {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices/1", nil))
+
+		if w.Code != code {
+			t.Errorf("request %d answered %d, want %d", i, w.Code, code)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// envelopeLimit is the largest JSON response inspected for its envelope status, bigger bodies are
+// streamed untouched.
+const envelopeLimit = 1 << 20
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// reverseProxy forwards the request to an HTTP composite. Bodies are streamed both ways, hop-by-hop
+// headers are dropped by httputil and X-Forwarded-* headers describe the original request.
+func (fwd chiForwarder) reverseProxy(w http.ResponseWriter, r *http.Request, composite *service.Composite) {
+	target := composite.Target()
+	basePath := composite.Endpoints()
+	escapedPath := r.URL.EscapedPath()
+	rawPath := trimEndpoint(escapedPath, basePath)
+	prefix := strings.TrimSuffix(escapedPath, rawPath)
+	rawPath = composite.Rewrite(rawPath)
+
+	// the path of the context, escaped or not as routed, differs once a script changed it, it's
+	// forwarded instead.
+	path := rawPath
+	if unescaped, err := url.PathUnescape(rawPath); err == nil {
+		path = unescaped
+	}
+
+	if current, ok := r.Context().Value(models.PathContextValueKey).(string); ok && current != path && current != rawPath {
+		rawPath = (&url.URL{Path: current}).EscapedPath()
+	}
+
+	identity, err := identityHeaders(r, composite)
+	if err != nil {
+		fwd.failure(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	trusted := isTrustedProxy(r)
+
+	proxy := &httputil.ReverseProxy{
+		Transport:     composite.Transport(),
+		FlushInterval: 100 * time.Millisecond,
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.RawPath = rawPath
+			req.URL.Path = rawPath
+			if path, err := url.PathUnescape(rawPath); err == nil {
+				req.URL.Path = path
+			}
+			req.Host = target.Host
+
+			// only trusted proxies describe the original request themselves.
+			if !trusted || req.Header.Get("X-Forwarded-Host") == "" {
+				req.Header.Set("X-Forwarded-Host", r.Host)
+			}
+
+			if !trusted || req.Header.Get("X-Forwarded-Proto") == "" {
+				req.Header.Set("X-Forwarded-Proto", proto)
+			}
+
+			req.Header.Set("X-Forwarded-Prefix", prefix)
+
+			for _, key := range identityHeaderKeys {
+				req.Header.Del(key)
+			}
+
+			for key, vals := range identity {
+				req.Header[key] = vals
+			}
+
+			// let the service choose its own agent instead of Go's default one.
+			if _, ok := req.Header["User-Agent"]; !ok {
+				req.Header.Set("User-Agent", "")
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			rewriteLocation(resp, target, r.Host, proto, prefix)
+			return envelopeStatus(resp)
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			fwd.upstreamFailure(w, r, composite, err)
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+
+	if route, ok := r.Context().Value(models.RouteContextValueKey).(*service.RouteInfo); ok {
+		L.Infof("request %s (%s %s) has been served by %s", r.RequestURI, r.Method, route.Template, target.Host)
+	} else {
+		L.Infof("request %s has been served by %s", r.RequestURI, target.Host)
+	}
+}
+
+// identityHeaderKeys are set by the gateway only, values sent by clients are dropped.
+var identityHeaderKeys = []string{
+	models.ClientInfoContextValueKey,
+	models.AuthorizationInfoContextValueKey,
+	models.AuthorizationSignatureValueKey,
+	models.BvRealIPTypeHeaderKey,
+	models.BvRealIPProofTypeHeaderKey,
+	models.BvXRemoteAddrTypeHeaderKey,
+}
+
+// identityHeaders carries what gRPC composites receive as metadata, see outgoingContext.
+func identityHeaders(r *http.Request, composite *service.Composite) (http.Header, error) {
+	header := http.Header{}
+
+	if clientInfo, ok := r.Context().Value(models.ClientInfoContextValueKey).(*models.ClientInfo); ok {
+		b, err := json.Marshal(clientInfo)
+		if err != nil {
+			return nil, fmt.Errorf("while marshaling json: %v", err)
+		}
+
+		header.Set(models.ClientInfoContextValueKey, string(b))
+	}
+
+	if authInfo, ok := r.Context().Value(models.AuthorizationInfoContextValueKey).(*models.AuthorizationInfo); ok {
+		b, err := json.Marshal(authInfo)
+		if err != nil {
+			return nil, fmt.Errorf("while marshaling json: %v", err)
+		}
+
+		header.Set(models.AuthorizationInfoContextValueKey, string(b))
+		if signature := composite.SignIdentity(string(b)); signature != "" {
+			header.Set(models.AuthorizationSignatureValueKey, signature)
+		}
+	}
+
+	realIP, ok := RecoverRealIP(r, int(helper.StringToInt(helper.Env("DEFAULT_SKIP_FORWARDED_FOR", "0"), 0)))
+	header.Set(models.BvXRemoteAddrTypeHeaderKey, r.RemoteAddr)
+	header.Set(models.BvRealIPTypeHeaderKey, realIP)
+	header.Set(models.BvRealIPProofTypeHeaderKey, helper.BoolToString(ok))
+
+	return header, nil
+}
+
+// rewriteLocation maps redirects pointing at the service back onto the gateway.
+func rewriteLocation(resp *http.Response, target *url.URL, host string, proto string, prefix string) {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case u.IsAbs():
+		if u.Host != target.Host {
+			return
+		}
+
+		u.Scheme = proto
+		u.Host = host
+
+	case u.Host != "" || !strings.HasPrefix(u.Path, "/"):
+		return
+	}
+
+	u.Path = prefix + u.Path
+	if u.RawPath != "" {
+		u.RawPath = prefix + u.RawPath
+	}
+
+	resp.Header.Set("Location", u.String())
+}
+
+// envelopeStatus keeps the historical behaviour of answering with the status carried by the
+// models.Response envelope of JSON responses. Anything that isn't an envelope passes untouched.
+func envelopeStatus(resp *http.Response) error {
+	contentType := strings.TrimSpace(strings.Split(resp.Header.Get(models.ContentTypeHeaderKey), ";")[0])
+	if contentType != models.ContentTypeValueJSON || resp.ContentLength > envelopeLimit {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, envelopeLimit+1))
+	if err != nil {
+		return err
+	}
+
+	if len(body) > envelopeLimit {
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body = readCloser{bytes.NewReader(body), resp.Body}
+
+	res := models.Response{}
+	if err := json.Unmarshal(body, &res); err == nil && res.Response >= 100 && res.Response <= 599 {
+		resp.StatusCode = res.Response
+		resp.Status = fmt.Sprintf("%d %s", res.Response, http.StatusText(res.Response))
+	}
+
+	return nil
+}
+
+func (fwd chiForwarder) upstreamFailure(w http.ResponseWriter, r *http.Request, composite *service.Composite, err error) {
+	var netErr net.Error
+
+	code := http.StatusBadGateway
+	message := "Layanan tidak dapat diakses"
+	switch {
+	case errors.Is(err, context.Canceled):
+		L.Infof("request %s to %s was canceled by the client", r.RequestURI, composite.Keys())
+		return
+
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		code = http.StatusGatewayTimeout
+		message = "Layanan tidak merespons"
+	}
+
+	L.Warnf("while proxying %s to %s: %v", r.RequestURI, composite.Keys(), err)
+
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(code)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   code,
+		Error:      message,
+		Svcid:      composite.Keys(),
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     "",
+	}))
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL)
+	host, port, _ := net.SplitHostPort(target.Host)
+
+	mux := chi.NewMux()
+	fwd := NewChiForwarder(nil, nil, nil, mux)
+	fwd.Mount(newTestComposite(t, `"host":"`+host+`","port":`+port+`,"key":"devices","gateway_endpoint":"/devices"`))
+
+	os.Setenv(libs.AppTrustedProxies, "10.0.0.0/8, 192.168.1.1")
+	defer os.Unsetenv(libs.AppTrustedProxies)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		wantHost   string
+		wantProto  string
+	}{
+		{"untrusted client", "203.0.113.1:1234", "gw.local", "http"},
+		{"trusted block", "10.1.2.3:1234", "spoofed.example", "https"},
+		{"trusted address", "192.168.1.1:1234", "spoofed.example", "https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://gw.local/devices/1", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("X-Forwarded-Host", "spoofed.example")
+			r.Header.Set("X-Forwarded-Proto", "https")
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			select {
+			case header := <-received:
+				if got := header.Get("X-Forwarded-Host"); got != tt.wantHost {
+					t.Errorf("X-Forwarded-Host = %s, want %s", got, tt.wantHost)
+				}
+
+				if got := header.Get("X-Forwarded-Proto"); got != tt.wantProto {
+					t.Errorf("X-Forwarded-Proto = %s, want %s", got, tt.wantProto)
+				}
+
+			default:
+				t.Errorf("request answered %d without reaching the upstream", w.Code)
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi"
 
 	"github.com/uzzeet/uzzeet-gateway/controller/auth"
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
 	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
 	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
 	"github.com/uzzeet/uzzeet-gateway/service"
@@ -16,33 +21,102 @@ type chiForwarder struct {
 	authService        auth.Service
 	strictAuthService  auth.Service
 	privateAuthService auth.Service
-	composite          map[string]*service.Composite
+	snapshot           *atomic.Value
+	// mirrors bounds the requests being mirrored to shadows at once.
+	mirrors chan struct{}
+	// cache holds the service.ResponseCache of the responses.
+	cache *atomic.Value
+	// limiter holds the service.RateLimiter the requests are counted with.
+	limiter *atomic.Value
+	// meter holds the service.UsageMeter the requests are metered with.
+	meter *atomic.Value
+	// outcomes holds the service.IdempotencyStore the outcomes of idempotent requests are kept in.
+	outcomes *atomic.Value
+	// chain serves the requests to composites and aggregates, Cleva calls go through it as well.
+	chain http.Handler
 }
 
 func NewChiForwarder(authService, strictAuthService, privateAuthService auth.Service, r chi.Router) service.Forwarder {
-	handler := &chiForwarder{&sync.Mutex{}, authService, strictAuthService, privateAuthService, make(map[string]*service.Composite)}
+	handler := &chiForwarder{
+		mutex:              &sync.Mutex{},
+		authService:        authService,
+		strictAuthService:  strictAuthService,
+		privateAuthService: privateAuthService,
+		snapshot:           &atomic.Value{},
+		mirrors:            make(chan struct{}, helper.StringToInt(helper.Env(libs.AppMirrorConcurrency, "64"), 64)),
+		cache:              &atomic.Value{},
+		limiter:            &atomic.Value{},
+		meter:              &atomic.Value{},
+		outcomes:           &atomic.Value{},
+	}
+	handler.UseCache(service.NewMemoryCache(int(helper.StringToInt(helper.Env(libs.AppCacheSize, "10000"), 10000))))
+	handler.UseRateLimiter(service.NewMemoryRateLimiter())
+	handler.UseUsageMeter(service.NewMemoryUsageMeter())
+	handler.UseIdempotencyStore(service.NewMemoryIdempotencyStore())
+	handler.snapshot.Store(newRoutingTable(make(map[string]*service.Composite), make(map[string]service.TrafficPolicy)))
+	handler.chain = chi.Chain(
+		handler.aggregation,
+		handler.serviceIdentification,
+		handler.routeValidation,
+		handler.anonymousRateLimit,
+		handler.limitBody,
+		handler.authorization,
+		handler.rateLimit,
+		handler.usageQuota,
+		handler.idempotency,
+		handler.trafficSplit,
+		handler.applyFilters,
+		handler.responseCache,
+		handler.trafficMirror,
+	).HandlerFunc(handler.forward)
 
 	r.Use(handler.agentIdentification)
+	r.Use(handler.grpcWeb)
 	r.Get("/", handler.hello)
-	r.Route("/{service}", func(r chi.Router) {
-		r.With(
-			handler.serviceIdentification,
-			handler.authorization,
-		).HandleFunc("/*", handler.forward)
-	})
+	r.With(handler.adminOnly).Get("/_routes", handler.routes)
+	r.With(handler.adminOnly).Delete("/_cache", handler.purgeCache)
+	r.With(handler.adminOnly).Get("/_usage/{by}/{id}", handler.usage)
+	r.With(handler.adminOnly).Delete("/_usage/{by}/{id}", handler.resetUsage)
+	r.Handle("/*", handler.chain)
 
 	return handler
 }
 
+// Mount publishes the composite, replacing the one with the same key. Writers are serialized
+// while readers keep using the previous snapshot until the new one is stored.
 func (fwd *chiForwarder) Mount(composite *service.Composite) {
 	fwd.mutex.Lock()
-	if old, ok := fwd.composite[composite.Keys()]; ok {
-		err := old.Stop()
-		if err != nil {
-			L.Err(serror.NewFromErrorc(err, "while mount service"))
-		}
+	table := fwd.table()
+	old, ok := table.composites[composite.Keys()]
+	fwd.snapshot.Store(table.with(composite))
+	fwd.mutex.Unlock()
+
+	if ok && old != composite {
+		go fwd.drain(old, "replaced")
 	}
+}
 
-	fwd.composite[composite.Keys()] = composite
+// Unmount removes the composite of the given key and drains it.
+func (fwd *chiForwarder) Unmount(key string) {
+	fwd.mutex.Lock()
+	table := fwd.table()
+	old, ok := table.composites[key]
+	if ok {
+		fwd.snapshot.Store(table.without(key))
+	}
 	fwd.mutex.Unlock()
+
+	if ok {
+		go fwd.drain(old, "removed")
+	}
+}
+
+func (fwd *chiForwarder) drain(old *service.Composite, reason string) {
+	timeout := time.Duration(helper.StringToInt(helper.Env(libs.AppDrainTimeout, "30"), 30)) * time.Second
+
+	L.Infof("draining %s service %s with %d call(s) in-flight", reason, old.Keys(), old.InFlight())
+	err := old.Drain(timeout)
+	if err != nil {
+		L.Err(serror.NewFromErrorc(err, "while draining service"))
+	}
 }
@@ -0,0 +1,586 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// The sizes bound the stacks of the sandbox, not the memory of the script: tables and strings it
+// builds aren't capped, only the timeout stops a script allocating in a loop. The body handed to
+// the script is bounded by APP_SCRIPT_MAX_BODY.
+const (
+	scriptCallStackSize   = 64
+	scriptRegistrySize    = 1024
+	scriptRegistryMaxSize = 64 * 1024
+
+	jsonNullKey  = "gateway.null"
+	jsonArrayKey = "gateway.array"
+)
+
+// scripts are the compiled policy scripts by name, they're swapped as a whole when the registry
+// publishes a new version so that running requests keep the version they started with.
+var scripts sync.Map
+
+func init() {
+	RegisterFilter("script", newScriptFilter)
+}
+
+// LoadScript compiles the script and makes it available to the script filter, scripts without
+// source are removed.
+func (fwd *chiForwarder) LoadScript(script service.Script) error {
+	err := script.Validate()
+	if err != nil {
+		return err
+	}
+
+	if !script.IsActive() {
+		scripts.Delete(script.Name)
+		L.Infof("script %s has been removed", script.Name)
+		return nil
+	}
+
+	proto, err := compileScript(script)
+	if err != nil {
+		return err
+	}
+
+	scripts.Store(script.Name, proto)
+	L.Infof("script %s has been loaded", script.Name)
+
+	return nil
+}
+
+func compileScript(script service.Script) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(script.Source), script.Name)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing script %s: %v", script.Name, err)
+	}
+
+	proto, err := lua.Compile(chunk, script.Name)
+	if err != nil {
+		return nil, fmt.Errorf("while compiling script %s: %v", script.Name, err)
+	}
+
+	return proto, nil
+}
+
+// scriptFilter runs a policy script of the registry. The script may define
+//
+//	function on_request(req) ... end
+//	function on_response(req, res) ... end
+//
+// where req holds method, path, query, headers, body, auth and client and res holds status,
+// headers, body and envelope, the decoded models.Response of JSON responses. Changes made to these
+// tables are applied, returning {status = 403, message = "..."} stops the request. JSON null is
+// the global null and decoded arrays stay arrays when emptied, array(t) marks a table built by the
+// script as one. Auth, client and envelope are only encoded again when the script changes them.
+type scriptFilter struct {
+	Name string `json:"name"`
+}
+
+func newScriptFilter(options json.RawMessage) (Filter, error) {
+	f := &scriptFilter{}
+	err := json.Unmarshal(options, f)
+	if err != nil {
+		return nil, fmt.Errorf("while decoding options: %v", err)
+	}
+
+	if f.Name == "" {
+		return nil, errors.New("name of the script is missing")
+	}
+
+	return f, nil
+}
+
+func (f *scriptFilter) OnRequest(r *http.Request) (*http.Request, error) {
+	run, err := f.start(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	defer run.close()
+
+	if run.state.GetGlobal("on_request") == lua.LNil {
+		return r, nil
+	}
+
+	maxBody := helper.StringToInt(helper.Env(libs.AppScriptMaxBody, "1048576"), 1048576)
+	if r.ContentLength > maxBody {
+		return nil, NewFilterError(http.StatusRequestEntityTooLarge, "Permintaan terlalu besar")
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		return nil, NewFilterError(http.StatusBadRequest, "Gagal membaca permintaan")
+	}
+
+	if int64(len(body)) > maxBody {
+		return nil, NewFilterError(http.StatusRequestEntityTooLarge, "Permintaan terlalu besar")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	req := run.request(r, body)
+	err = run.call("on_request", req)
+	if err != nil {
+		return nil, err
+	}
+
+	return run.applyRequest(r, req)
+}
+
+func (f *scriptFilter) OnResponse(r *http.Request, res *FilterResponse) error {
+	run, err := f.start(r.Context())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	if run.state.GetGlobal("on_response") == lua.LNil {
+		return nil
+	}
+
+	// the body of the request has been sent to the service by now.
+	req := run.request(r, nil)
+
+	var envelope interface{}
+	if isJSON(res.Header) {
+		_ = json.Unmarshal(res.Body, &envelope)
+	}
+
+	out := run.state.NewTable()
+	out.RawSetString("status", lua.LNumber(res.Status))
+	out.RawSetString("headers", headerTable(run.state, res.Header))
+	out.RawSetString("body", lua.LString(res.Body))
+	if envelope != nil {
+		out.RawSetString("envelope", toLua(run.state, envelope))
+	}
+
+	err = run.call("on_response", req, out)
+	if err != nil {
+		return err
+	}
+
+	if status, ok := out.RawGetString("status").(lua.LNumber); ok && status >= 100 && status <= 599 {
+		res.Status = int(status)
+	}
+
+	applyHeaderTable(res.Header, out.RawGetString("headers"))
+
+	if body, ok := out.RawGetString("body").(lua.LString); ok && string(body) != string(res.Body) {
+		res.Body = []byte(body)
+		return nil
+	}
+
+	if envelope != nil {
+		b, err := json.Marshal(fromLua(run.state, out.RawGetString("envelope")))
+		if err != nil {
+			return fmt.Errorf("while marshaling json: %v", err)
+		}
+
+		// the envelope is only encoded again when the script changed it, so that untouched
+		// responses keep their formatting.
+		if original, _ := json.Marshal(envelope); !bytes.Equal(original, b) {
+			res.Body = b
+		}
+	}
+
+	return nil
+}
+
+type scriptRun struct {
+	name   string
+	state  *lua.LState
+	cancel context.CancelFunc
+
+	// auth and client are the tables handed to the script, encoded to tell whether it changed them.
+	auth   []byte
+	client []byte
+}
+
+// start prepares a sandbox running the script, only the base, table, string and math libraries
+// are available and the run is canceled once the script timeout expires.
+func (f *scriptFilter) start(ctx context.Context) (*scriptRun, error) {
+	v, ok := scripts.Load(f.Name)
+	if !ok {
+		return nil, fmt.Errorf("script %s isn't loaded", f.Name)
+	}
+
+	state := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   scriptCallStackSize,
+		RegistrySize:    scriptRegistrySize,
+		RegistryMaxSize: scriptRegistryMaxSize,
+	})
+
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage", "print", "_printregs"} {
+		state.SetGlobal(name, lua.LNil)
+	}
+
+	// string.rep allocates without running any instruction, the timeout can't stop it.
+	if lib, ok := state.GetGlobal(lua.StringLibName).(*lua.LTable); ok {
+		lib.RawSetString("rep", lua.LNil)
+	}
+
+	timeout := time.Duration(helper.StringToInt(helper.Env(libs.AppScriptTimeout, "50"), 50)) * time.Millisecond
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, timeout)
+	state.SetContext(ctx)
+	state.SetGlobal("null", jsonNull(state))
+	state.SetGlobal("array", state.NewFunction(markArray))
+
+	run := &scriptRun{name: f.Name, state: state, cancel: cancel}
+
+	state.Push(state.NewFunctionFromProto(v.(*lua.FunctionProto)))
+	err := state.PCall(0, 0, nil)
+	if err != nil {
+		run.close()
+		return nil, fmt.Errorf("while running script %s: %v", f.Name, err)
+	}
+
+	return run, nil
+}
+
+func (run *scriptRun) close() {
+	run.cancel()
+	run.state.Close()
+}
+
+// call runs the hook if the script defines it, a table returned by the hook rejects the request.
+func (run *scriptRun) call(hook string, args ...lua.LValue) error {
+	fn := run.state.GetGlobal(hook)
+	if fn == lua.LNil {
+		return nil
+	}
+
+	err := run.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...)
+	if err != nil {
+		return fmt.Errorf("while running %s of script %s: %v", hook, run.name, err)
+	}
+
+	ret := run.state.Get(-1)
+	run.state.Pop(1)
+
+	rejection, ok := ret.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+
+	filterErr := NewFilterError(http.StatusForbidden, "Akses ditolak")
+	if status, ok := rejection.RawGetString("status").(lua.LNumber); ok && status >= 400 && status <= 599 {
+		filterErr.Status = int(status)
+	}
+
+	if message, ok := rejection.RawGetString("message").(lua.LString); ok && message != "" {
+		filterErr.Message = string(message)
+	}
+
+	return filterErr
+}
+
+func (run *scriptRun) request(r *http.Request, body []byte) *lua.LTable {
+	state := run.state
+	req := state.NewTable()
+
+	path, _ := r.Context().Value(models.PathContextValueKey).(string)
+	req.RawSetString("method", lua.LString(r.Method))
+	req.RawSetString("path", lua.LString(path))
+	req.RawSetString("body", lua.LString(body))
+	req.RawSetString("headers", headerTable(state, r.Header))
+
+	query := state.NewTable()
+	for key, vals := range r.URL.Query() {
+		query.RawSetString(key, lua.LString(vals[0]))
+	}
+	req.RawSetString("query", query)
+
+	if authInfo, ok := r.Context().Value(models.AuthorizationInfoContextValueKey).(*models.AuthorizationInfo); ok {
+		auth := structTable(state, authInfo)
+		req.RawSetString("auth", auth)
+		run.auth, _ = json.Marshal(fromLua(state, auth))
+	}
+
+	if clientInfo, ok := r.Context().Value(models.ClientInfoContextValueKey).(*models.ClientInfo); ok {
+		client := structTable(state, clientInfo)
+		req.RawSetString("client", client)
+		run.client, _ = json.Marshal(fromLua(state, client))
+	}
+
+	return req
+}
+
+// applyRequest applies the changes the script made to the request table.
+func (run *scriptRun) applyRequest(r *http.Request, req *lua.LTable) (*http.Request, error) {
+	ctx := r.Context()
+
+	current, _ := ctx.Value(models.PathContextValueKey).(string)
+	if path, ok := req.RawGetString("path").(lua.LString); ok && string(path) != current {
+		ctx = context.WithValue(ctx, models.PathContextValueKey, "/"+strings.TrimLeft(string(path), "/"))
+	}
+
+	if auth, ok := req.RawGetString("auth").(*lua.LTable); ok {
+		authInfo := &models.AuthorizationInfo{}
+		changed, err := tableStruct(run.state, auth, run.auth, authInfo)
+		if err != nil {
+			return nil, fmt.Errorf("while reading auth of script %s: %v", run.name, err)
+		}
+
+		if changed {
+			ctx = context.WithValue(ctx, models.AuthorizationInfoContextValueKey, authInfo)
+		}
+	}
+
+	if client, ok := req.RawGetString("client").(*lua.LTable); ok {
+		clientInfo := &models.ClientInfo{}
+		changed, err := tableStruct(run.state, client, run.client, clientInfo)
+		if err != nil {
+			return nil, fmt.Errorf("while reading client of script %s: %v", run.name, err)
+		}
+
+		if changed {
+			ctx = context.WithValue(ctx, models.ClientInfoContextValueKey, clientInfo)
+		}
+	}
+
+	r = r.WithContext(ctx)
+
+	applyHeaderTable(r.Header, req.RawGetString("headers"))
+
+	if query, ok := req.RawGetString("query").(*lua.LTable); ok {
+		original := r.URL.Query()
+		values := url.Values{}
+		query.ForEach(func(key lua.LValue, val lua.LValue) {
+			// repeated parameters the script didn't touch are kept as they were.
+			if vals, ok := original[key.String()]; ok && len(vals) > 0 && vals[0] == val.String() {
+				values[key.String()] = vals
+				return
+			}
+
+			values.Set(key.String(), val.String())
+		})
+		r.URL.RawQuery = values.Encode()
+	}
+
+	if body, ok := req.RawGetString("body").(lua.LString); ok {
+		r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		r.ContentLength = int64(len(body))
+	}
+
+	return r, nil
+}
+
+func isJSON(header http.Header) bool {
+	contentType := strings.TrimSpace(strings.Split(header.Get(models.ContentTypeHeaderKey), ";")[0])
+	return contentType == models.ContentTypeValueJSON
+}
+
+func headerTable(state *lua.LState, header http.Header) *lua.LTable {
+	tbl := state.NewTable()
+	for key, vals := range header {
+		if len(vals) > 0 {
+			tbl.RawSetString(key, lua.LString(vals[0]))
+		}
+	}
+
+	return tbl
+}
+
+// applyHeaderTable removes the headers missing from the table and sets the changed ones.
+func applyHeaderTable(header http.Header, val lua.LValue) {
+	tbl, ok := val.(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	seen := make(map[string]bool)
+	tbl.ForEach(func(key lua.LValue, val lua.LValue) {
+		name := http.CanonicalHeaderKey(key.String())
+		seen[name] = true
+
+		if vals := header[name]; len(vals) > 0 && vals[0] == val.String() {
+			return
+		}
+
+		header.Set(name, val.String())
+	})
+
+	for key := range header {
+		if !seen[http.CanonicalHeaderKey(key)] {
+			header.Del(key)
+		}
+	}
+}
+
+func structTable(state *lua.LState, v interface{}) lua.LValue {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return lua.LNil
+	}
+
+	var res interface{}
+	_ = json.Unmarshal(b, &res)
+
+	return toLua(state, res)
+}
+
+// tableStruct decodes the table into v unless it still encodes as original, it tells whether the
+// table was decoded.
+func tableStruct(state *lua.LState, tbl *lua.LTable, original []byte, v interface{}) (bool, error) {
+	b, err := json.Marshal(fromLua(state, tbl))
+	if err != nil {
+		return false, err
+	}
+
+	if bytes.Equal(b, original) {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(b, v)
+}
+
+// jsonNull is the value JSON null is decoded to, keys holding nil would vanish from their table.
+func jsonNull(state *lua.LState) lua.LValue {
+	if v := state.G.Registry.RawGetString(jsonNullKey); v != lua.LNil {
+		return v
+	}
+
+	v := state.NewUserData()
+	state.G.Registry.RawSetString(jsonNullKey, v)
+
+	return v
+}
+
+// jsonArray is the metatable of the tables decoded from JSON arrays, so that they're still encoded
+// as arrays once emptied.
+func jsonArray(state *lua.LState) *lua.LTable {
+	if v, ok := state.G.Registry.RawGetString(jsonArrayKey).(*lua.LTable); ok {
+		return v
+	}
+
+	v := state.NewTable()
+	state.G.Registry.RawSetString(jsonArrayKey, v)
+
+	return v
+}
+
+// markArray is array(t) of the scripts, it returns t, or a new table, encoded as a JSON array.
+func markArray(state *lua.LState) int {
+	tbl := state.OptTable(1, state.NewTable())
+	tbl.Metatable = jsonArray(state)
+	state.Push(tbl)
+
+	return 1
+}
+
+// toLua converts a decoded JSON value to Lua.
+func toLua(state *lua.LState, v interface{}) lua.LValue {
+	switch val := v.(type) {
+	case nil:
+		return jsonNull(state)
+
+	case bool:
+		return lua.LBool(val)
+
+	case float64:
+		return lua.LNumber(val)
+
+	case string:
+		return lua.LString(val)
+
+	case []interface{}:
+		tbl := state.NewTable()
+		for _, each := range val {
+			tbl.Append(toLua(state, each))
+		}
+		tbl.Metatable = jsonArray(state)
+
+		return tbl
+
+	case map[string]interface{}:
+		tbl := state.NewTable()
+		for key, each := range val {
+			tbl.RawSetString(key, toLua(state, each))
+		}
+
+		return tbl
+	}
+
+	return lua.LNil
+}
+
+// fromLua converts a Lua value to a value encodable as JSON, tables decoded from arrays and tables
+// with consecutive integer keys only are arrays.
+func fromLua(state *lua.LState, v lua.LValue) interface{} {
+	switch val := v.(type) {
+	case lua.LBool:
+		return bool(val)
+
+	case lua.LNumber:
+		return float64(val)
+
+	case lua.LString:
+		return string(val)
+
+	case *lua.LUserData:
+		if val == jsonNull(state) {
+			return json.RawMessage("null")
+		}
+
+	case *lua.LTable:
+		n := val.MaxN()
+		isArray := val.Metatable == jsonArray(state)
+		if !isArray && n > 0 {
+			count := 0
+			val.ForEach(func(lua.LValue, lua.LValue) { count++ })
+			isArray = count == n
+		}
+
+		if isArray {
+			res := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				res = append(res, fromLua(state, val.RawGetInt(i)))
+			}
+
+			return res
+		}
+
+		res := make(map[string]interface{})
+		val.ForEach(func(key lua.LValue, each lua.LValue) {
+			res[key.String()] = fromLua(state, each)
+		})
+
+		return res
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi"
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+func TestLuaRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"null", `null`},
+		{"empty array", `[]`},
+		{"empty object", `{}`},
+		{"array with null", `[1,null,"a"]`},
+		{"nested", `{"a":null,"b":[],"c":{"d":[true,false]},"e":1.5}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := lua.NewState()
+			defer state.Close()
+
+			var v interface{}
+			err := json.Unmarshal([]byte(tt.in), &v)
+			if err != nil {
+				t.Fatalf("while decoding json: %v", err)
+			}
+
+			b, err := json.Marshal(fromLua(state, toLua(state, v)))
+			if err != nil {
+				t.Fatalf("while encoding json: %v", err)
+			}
+
+			if string(b) != tt.in {
+				t.Errorf("round trip of %s = %s", tt.in, b)
+			}
+		})
+	}
+}
+
+func TestTableStruct(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		changed bool
+		access  int
+		org     string
+	}{
+		{"untouched", ``, false, 1, "o1"},
+		{"emptied array", `table.remove(auth.user_access)`, true, 0, "o1"},
+		{"array built by the script", `auth.user_access = array()`, true, 0, "o1"},
+		{"changed field", `auth.organization_id = "o2"`, true, 1, "o2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := lua.NewState()
+			defer state.Close()
+			state.SetGlobal("array", state.NewFunction(markArray))
+
+			auth := structTable(state, &models.AuthorizationInfo{UserID: "u1", OrganizationId: "o1", UserAccess: []interface{}{"admin"}})
+			original, _ := json.Marshal(fromLua(state, auth))
+
+			state.SetGlobal("auth", auth)
+			err := state.DoString(tt.script)
+			if err != nil {
+				t.Fatalf("while running script: %v", err)
+			}
+
+			got := models.AuthorizationInfo{}
+			changed, err := tableStruct(state, auth.(*lua.LTable), original, &got)
+			if err != nil {
+				t.Fatalf("tableStruct() error = %v", err)
+			}
+
+			if changed != tt.changed {
+				t.Errorf("tableStruct() changed = %v, want %v", changed, tt.changed)
+			}
+
+			if changed && (got.UserID != "u1" || got.OrganizationId != tt.org || got.UserAccess == nil || len(got.UserAccess) != tt.access) {
+				t.Errorf("tableStruct() decoded %+v", got)
+			}
+		})
+	}
+}
+
+func TestScriptPath(t *testing.T) {
+	received := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.EscapedPath()
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL)
+	host, port, _ := net.SplitHostPort(target.Host)
+
+	tests := []struct {
+		name   string
+		script string
+		path   string
+		want   string
+	}{
+		{"untouched", ``, "/devices/a%2Fb", "/a%2Fb"},
+		{"changed", `function on_request(req) req.path = "/v2" .. req.path end`, "/devices/1", "/v2/1"},
+		{"changed with escaping", `function on_request(req) req.path = "/a b" end`, "/devices/1", "/a%20b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewMux()
+			fwd := NewChiForwarder(nil, nil, nil, mux).(*chiForwarder)
+			err := fwd.LoadScript(service.Script{Name: "path", Source: tt.script + "\n"})
+			if err != nil {
+				t.Fatalf("while loading script: %v", err)
+			}
+
+			fwd.Mount(newTestComposite(t, `"host":"`+host+`","port":`+port+`,"key":"devices","gateway_endpoint":"/devices",
+				"filters":[{"name":"script","options":{"name":"path"}}]`))
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			select {
+			case got := <-received:
+				if got != tt.want {
+					t.Errorf("upstream received %s, want %s", got, tt.want)
+				}
+
+			default:
+				t.Errorf("request answered %d without reaching the upstream", w.Code)
+			}
+		})
+	}
+}
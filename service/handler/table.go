@@ -0,0 +1,398 @@
+package handler
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	L "github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// routingTable is an immutable snapshot of the mounted composites. It's rebuilt and swapped as a
+// whole on every mount, so requests read it without any lock.
+type routingTable struct {
+	composites map[string]*service.Composite
+	// endpoints are indexed by virtual host first, composites reachable on any host are under "".
+	endpoints map[string]map[string]*endpointEntry
+	services  map[string]*service.Composite
+	// splits are traffic policies keyed by their stable composite.
+	splits map[string]service.TrafficPolicy
+	// previews index the composites of each preview tag, they're only reachable by requests asking
+	// for that preview.
+	previews map[string]*routingTable
+	// chains are the filter chains of the composites, they're built once when a composite is
+	// mounted.
+	chains map[string]*filterChain
+	// aggregates are keyed by the method and path they're served on.
+	aggregates map[string]service.Aggregate
+	// quotas are keyed by their subject.
+	quotas map[string]service.Quota
+}
+
+// endpointEntry holds every version of the service mounted on an endpoint. The default one serves
+// requests without version, it's the unversioned composite or else the latest version. Pinned
+// entries are the /v2/devices form of a versioned endpoint and ignore Accept-Version, so do entries
+// without any version.
+type endpointEntry struct {
+	versions map[string]*service.Composite
+	fallback *service.Composite
+	pinned   bool
+}
+
+func (e *endpointEntry) resolve(version string) *service.Composite {
+	if version == "" || e.pinned || len(e.versions) == 0 {
+		return e.fallback
+	}
+
+	return e.versions[version]
+}
+
+func newRoutingTable(composites map[string]*service.Composite, splits map[string]service.TrafficPolicy) *routingTable {
+	t := &routingTable{
+		composites: composites,
+		endpoints:  make(map[string]map[string]*endpointEntry),
+		services:   make(map[string]*service.Composite),
+		splits:     splits,
+		previews:   make(map[string]*routingTable),
+		chains:     make(map[string]*filterChain),
+		aggregates: make(map[string]service.Aggregate),
+		quotas:     make(map[string]service.Quota),
+	}
+
+	// canaries are only reachable through the split of their stable composite, shadows only
+	// receive the copies of the requests of their primary.
+	hidden := make(map[string]bool)
+	for _, policy := range splits {
+		if _, ok := composites[policy.Stable]; ok {
+			hidden[policy.Canary] = true
+		}
+	}
+
+	for key, composite := range composites {
+		if mirror := composite.Config().Mirror; mirror != nil && mirror.Shadow != "" && mirror.Shadow != key {
+			hidden[mirror.Shadow] = true
+		}
+	}
+
+	// keys are sorted so that conflicting composites always resolve the same way.
+	keys := []string{}
+	for key := range composites {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	previews := make(map[string][]string)
+	for _, key := range keys {
+		if hidden[key] {
+			continue
+		}
+
+		if preview := normalizePreview(composites[key].Config().Preview); preview != "" {
+			previews[preview] = append(previews[preview], key)
+			continue
+		}
+
+		t.index(key, composites[key])
+	}
+
+	for preview, keys := range previews {
+		sub := &routingTable{
+			composites: composites,
+			endpoints:  make(map[string]map[string]*endpointEntry),
+			services:   make(map[string]*service.Composite),
+		}
+
+		for _, key := range keys {
+			sub.index(key, composites[key])
+		}
+
+		t.previews[preview] = sub
+	}
+
+	return t
+}
+
+// index registers the endpoints and typed services of the composite.
+func (t *routingTable) index(key string, composite *service.Composite) {
+	endpoint := normalizeEndpoint(composite.Endpoints())
+	version := composite.Version()
+
+	hosts := []string{""}
+	if len(composite.Hosts()) > 0 {
+		hosts = []string{}
+		for _, host := range composite.Hosts() {
+			hosts = append(hosts, normalizeHost(host))
+		}
+	}
+
+	for _, host := range hosts {
+		t.register(host, endpoint, version, composite, false)
+		if version != "" {
+			t.register(host, normalizeEndpoint(version+endpoint), "", composite, true)
+		}
+	}
+
+	for _, name := range composite.ServiceNames() {
+		if other, ok := t.services[name]; ok {
+			L.Warnf("grpc service %s of service %s is already served by %s", name, key, other.Keys())
+			continue
+		}
+
+		t.services[name] = composite
+	}
+}
+
+func (t *routingTable) register(host string, endpoint string, version string, composite *service.Composite, pinned bool) {
+	if t.endpoints[host] == nil {
+		t.endpoints[host] = make(map[string]*endpointEntry)
+	}
+
+	entry, ok := t.endpoints[host][endpoint]
+	if !ok {
+		entry = &endpointEntry{
+			versions: make(map[string]*service.Composite),
+			pinned:   pinned,
+		}
+		t.endpoints[host][endpoint] = entry
+	}
+
+	if entry.pinned != pinned {
+		L.Warnf("endpoint %s%s of service %s conflicts with a versioned endpoint", host, endpoint, composite.Keys())
+		return
+	}
+
+	if version == "" {
+		if entry.fallback != nil && entry.fallback.Version() == "" {
+			L.Warnf("endpoint %s%s of service %s is already served by %s", host, endpoint, composite.Keys(), entry.fallback.Keys())
+			return
+		}
+
+		entry.fallback = composite
+		return
+	}
+
+	if other, ok := entry.versions[version]; ok {
+		L.Warnf("endpoint %s%s %s of service %s is already served by %s", host, endpoint, version, composite.Keys(), other.Keys())
+		return
+	}
+
+	entry.versions[version] = composite
+	if entry.fallback == nil || (entry.fallback.Version() != "" && service.CompareVersion(version, entry.fallback.Version()) > 0) {
+		entry.fallback = composite
+	}
+}
+
+// lookup finds the composite with the longest endpoint prefixing the path, at the same length a
+// composite bound to the host wins over one reachable on any host. The version comes from the
+// Accept-Version header, the path form /v2/devices is an endpoint of its own. A composite of the
+// requested preview wins over the default one unless the latter has a longer endpoint. It returns
+// the path left once the endpoint is trimmed.
+func (t *routingTable) lookup(host string, path string, version string, preview string) (*service.Composite, string) {
+	composite, rest, length := t.match(host, path, version)
+
+	if sub, ok := t.previews[normalizePreview(preview)]; ok {
+		if c, r, l := sub.match(host, path, version); c != nil && (composite == nil || l >= length) {
+			return c, r
+		}
+	}
+
+	return composite, rest
+}
+
+// match is lookup within a single table, it also returns the length of the matched endpoint.
+func (t *routingTable) match(host string, path string, version string) (*service.Composite, string, int) {
+	host = normalizeHost(host)
+	path = "/" + strings.TrimLeft(path, "/")
+	version = service.NormalizeVersion(version)
+
+	prefix := strings.TrimRight(path, "/")
+	for {
+		endpoint := prefix
+		if endpoint == "" {
+			endpoint = "/"
+		}
+
+		for _, h := range []string{host, ""} {
+			if entry, ok := t.endpoints[h][endpoint]; ok {
+				rest := path
+				if endpoint != "/" {
+					rest = path[len(prefix):]
+				}
+
+				if rest == "" {
+					rest = "/"
+				}
+
+				return entry.resolve(version), rest, len(prefix)
+			}
+		}
+
+		if prefix == "" {
+			return nil, "", 0
+		}
+
+		prefix = prefix[:strings.LastIndex(prefix, "/")]
+	}
+}
+
+// with returns a copy of the table where the composite replaces the one with the same key.
+func (t *routingTable) with(composite *service.Composite) *routingTable {
+	composites := make(map[string]*service.Composite, len(t.composites)+1)
+	for key, each := range t.composites {
+		composites[key] = each
+	}
+	composites[composite.Keys()] = composite
+
+	next := t.derive(composites, t.splits)
+	next.chains[composite.Keys()] = newFilterChain(composite)
+
+	return next
+}
+
+// without returns a copy of the table without the composite of the given key.
+func (t *routingTable) without(key string) *routingTable {
+	composites := make(map[string]*service.Composite, len(t.composites))
+	for k, each := range t.composites {
+		if k != key {
+			composites[k] = each
+		}
+	}
+
+	return t.derive(composites, t.splits)
+}
+
+// withSplit returns a copy of the table applying the traffic policy, inactive policies remove the
+// split of their stable composite.
+func (t *routingTable) withSplit(policy service.TrafficPolicy) *routingTable {
+	splits := make(map[string]service.TrafficPolicy, len(t.splits)+1)
+	for key, each := range t.splits {
+		splits[key] = each
+	}
+
+	delete(splits, policy.Stable)
+	if policy.IsActive() {
+		splits[policy.Stable] = policy
+	}
+
+	return t.derive(t.composites, splits)
+}
+
+// withAggregate returns a copy of the table serving the aggregate, inactive aggregates are removed.
+func (t *routingTable) withAggregate(aggregate service.Aggregate) *routingTable {
+	aggregates := make(map[string]service.Aggregate, len(t.aggregates)+1)
+	for route, each := range t.aggregates {
+		if each.Name != aggregate.Name {
+			aggregates[route] = each
+		}
+	}
+
+	if aggregate.IsActive() {
+		aggregates[aggregate.Route()] = aggregate
+	}
+
+	next := *t
+	next.aggregates = aggregates
+
+	return &next
+}
+
+// withQuota returns a copy of the table enforcing the quota, quotas without bounds are removed.
+func (t *routingTable) withQuota(quota service.Quota) *routingTable {
+	quotas := make(map[string]service.Quota, len(t.quotas)+1)
+	for subject, each := range t.quotas {
+		quotas[subject] = each
+	}
+
+	delete(quotas, quota.Subject())
+	if quota.IsActive() {
+		quotas[quota.Subject()] = quota
+	}
+
+	next := *t
+	next.quotas = quotas
+
+	return &next
+}
+
+// derive rebuilds the table over the given composites and splits, filter chains of the remaining
+// composites, aggregates and quotas are kept.
+func (t *routingTable) derive(composites map[string]*service.Composite, splits map[string]service.TrafficPolicy) *routingTable {
+	next := newRoutingTable(composites, splits)
+	for key, chain := range t.chains {
+		if _, ok := composites[key]; ok {
+			next.chains[key] = chain
+		}
+	}
+	next.aggregates = t.aggregates
+	next.quotas = t.quotas
+
+	return next
+}
+
+// chainOf returns the filter chain of the composite.
+func (t *routingTable) chainOf(composite *service.Composite) *filterChain {
+	return t.chains[composite.Keys()]
+}
+
+// canaryOf returns the canary of the composite along with its traffic policy, if any.
+func (t *routingTable) canaryOf(composite *service.Composite) (*service.Composite, service.TrafficPolicy, bool) {
+	policy, ok := t.splits[composite.Keys()]
+	if !ok {
+		return nil, policy, false
+	}
+
+	canary, ok := t.composites[policy.Canary]
+	if !ok {
+		return nil, policy, false
+	}
+
+	return canary, policy, true
+}
+
+// shadowOf returns the shadow the composite mirrors its requests to, if it's mounted.
+func (t *routingTable) shadowOf(composite *service.Composite) (*service.Composite, service.Mirror, bool) {
+	mirror := composite.Config().Mirror
+	if mirror == nil || mirror.Sample <= 0 || mirror.Shadow == composite.Keys() {
+		return nil, service.Mirror{}, false
+	}
+
+	shadow, ok := t.composites[mirror.Shadow]
+	if !ok {
+		return nil, *mirror, false
+	}
+
+	return shadow, *mirror, true
+}
+
+func normalizeEndpoint(endpoint string) string {
+	return "/" + strings.Trim(endpoint, "/")
+}
+
+// lookupService finds the composite serving the typed gRPC service, preferring the one of the
+// requested preview.
+func (t *routingTable) lookupService(name string, preview string) *service.Composite {
+	if sub, ok := t.previews[normalizePreview(preview)]; ok {
+		if composite, ok := sub.services[name]; ok {
+			return composite
+		}
+	}
+
+	return t.services[name]
+}
+
+func normalizePreview(preview string) string {
+	return strings.ToLower(strings.TrimSpace(preview))
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func (fwd chiForwarder) table() *routingTable {
+	return fwd.snapshot.Load().(*routingTable)
+}
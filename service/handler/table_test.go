@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/uzzeet/uzzeet-gateway/controller/resolver/manual"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+// newTestComposite creates an HTTP composite from the fields of its registry entry, it never
+// connects to its service.
+func newTestComposite(t *testing.T, fields string) *service.Composite {
+	t.Helper()
+
+	var cfg service.Config
+	err := cfg.UnmarshalJSON([]byte(`{"host":"127.0.0.1","port":1,"typeconn":"http",` + fields + `}`))
+	if err != nil {
+		t.Fatalf("while decoding config: %v", err)
+	}
+
+	resolv, _ := manual.NewManualResolver()
+	composite, err := service.NewComposite(resolv, cfg)
+	if err != nil {
+		t.Fatalf("while creating composite: %v", err)
+	}
+
+	return composite
+}
+
+func TestRoutingTableSnapshot(t *testing.T) {
+	devices := newTestComposite(t, `"key":"devices","gateway_endpoint":"/devices"`)
+	replacement := newTestComposite(t, `"key":"devices","gateway_endpoint":"/devices"`)
+	users := newTestComposite(t, `"key":"users","gateway_endpoint":"/users"`)
+
+	empty := newRoutingTable(map[string]*service.Composite{}, map[string]service.TrafficPolicy{})
+	mounted := empty.with(devices).with(users)
+	replaced := mounted.with(replacement)
+	unmounted := replaced.without("devices")
+
+	tests := []struct {
+		name  string
+		table *routingTable
+		path  string
+		want  *service.Composite
+	}{
+		{"empty table", empty, "/devices/1", nil},
+		{"mounted", mounted, "/devices/1", devices},
+		{"other composite", mounted, "/users/1", users},
+		{"replaced", replaced, "/devices/1", replacement},
+		{"unmounted", unmounted, "/devices/1", nil},
+		{"unmounted keeps the others", unmounted, "/users/1", users},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := tt.table.lookup("gw.local", tt.path, "", ""); got != tt.want {
+				t.Errorf("lookup(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingTableMatch(t *testing.T) {
+	composites := map[string]*service.Composite{}
+	for _, fields := range []string{
+		`"key":"devices","gateway_endpoint":"/devices"`,
+		`"key":"devices-v2","gateway_endpoint":"/devices","version":"v2"`,
+		`"key":"admin","gateway_endpoint":"/devices/admin"`,
+		`"key":"tenant","gateway_endpoint":"/devices","gateway_hosts":["api.example.com"]`,
+	} {
+		composite := newTestComposite(t, fields)
+		composites[composite.Keys()] = composite
+	}
+
+	table := newRoutingTable(composites, map[string]service.TrafficPolicy{})
+
+	tests := []struct {
+		name    string
+		host    string
+		path    string
+		version string
+		want    string
+		rest    string
+	}{
+		{"unversioned composite", "gw.local", "/devices/1", "", "devices", "/1"},
+		{"requested version", "gw.local", "/devices/1", "2", "devices-v2", "/1"},
+		{"unknown version", "gw.local", "/devices/1", "v3", "", "/1"},
+		{"pinned version", "gw.local", "/v2/devices/1", "", "devices-v2", "/1"},
+		{"pinned version ignores Accept-Version", "gw.local", "/v2/devices/1", "v9", "devices-v2", "/1"},
+		{"longest prefix", "gw.local", "/devices/admin/users", "", "admin", "/users"},
+		{"endpoint itself", "gw.local", "/devices", "", "devices", "/"},
+		{"virtual host", "API.example.com:8080", "/devices/1", "", "tenant", "/1"},
+		{"partial segment", "gw.local", "/devicesx", "", "", ""},
+		{"unknown endpoint", "gw.local", "/things", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			composite, rest, _ := table.match(tt.host, tt.path, tt.version)
+
+			got := ""
+			if composite != nil {
+				got = composite.Keys()
+			}
+
+			if got != tt.want || rest != tt.rest {
+				t.Errorf("match(%q, %q, %q) = %q, %q, want %q, %q", tt.host, tt.path, tt.version, got, rest, tt.want, tt.rest)
+			}
+		})
+	}
+}
+
+func TestEndpointEntryResolve(t *testing.T) {
+	v1 := newTestComposite(t, `"key":"v1","gateway_endpoint":"/devices","version":"v1"`)
+	v2 := newTestComposite(t, `"key":"v2","gateway_endpoint":"/devices","version":"v2"`)
+	plain := newTestComposite(t, `"key":"plain","gateway_endpoint":"/devices"`)
+
+	versioned := &endpointEntry{versions: map[string]*service.Composite{"v1": v1, "v2": v2}, fallback: v2}
+
+	tests := []struct {
+		name    string
+		entry   *endpointEntry
+		version string
+		want    *service.Composite
+	}{
+		{"no version", versioned, "", v2},
+		{"known version", versioned, "v1", v1},
+		{"unknown version", versioned, "v3", nil},
+		{"pinned entry", &endpointEntry{versions: map[string]*service.Composite{"v1": v1}, fallback: v1, pinned: true}, "v2", v1},
+		{"unversioned entry", &endpointEntry{versions: map[string]*service.Composite{}, fallback: plain}, "v2", plain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.resolve(tt.version); got != tt.want {
+				t.Errorf("resolve(%q) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/uzzeet/uzzeet-gateway/models"
+	"github.com/uzzeet/uzzeet-gateway/service"
+)
+
+func (fwd chiForwarder) transcode(w http.ResponseWriter, r *http.Request, composite *service.Composite) {
+	path := r.Context().Value(models.PathContextValueKey).(string)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fwd.failure(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx, err := outgoingContext(r)
+	if err != nil {
+		fwd.failure(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	code, result, err := composite.Transcode(ctx, r.Method, path, r.URL.Query(), body)
+	if err != nil {
+		stat := status.Convert(err)
+		fwd.failure(w, r, httpStatusFromCode(stat.Code()), stat.Message())
+		return
+	}
+
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(code)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   code,
+		Svcid:      composite.Keys(),
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     result,
+	}))
+}
+
+func (fwd chiForwarder) failure(w http.ResponseWriter, r *http.Request, code int, message string) {
+	w.Header().Set(models.ContentTypeHeaderKey, models.ContentTypeValueJSON)
+	w.WriteHeader(code)
+	logger(json.NewEncoder(w).Encode(models.Response{
+		Response:   code,
+		Error:      message,
+		Controller: r.RequestURI,
+		Action:     r.Method,
+		Result:     "",
+	}))
+}
+
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+
+	case codes.NotFound:
+		return http.StatusNotFound
+
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+
+	case codes.Canceled:
+		return 499
+
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+
+	default:
+		return http.StatusInternalServerError
+	}
+}
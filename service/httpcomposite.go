@@ -0,0 +1,197 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+)
+
+func newHttpComposite(connURL string, cfg Config) (*Composite, error) {
+	logger.Infof("connecting http composite %s(%s)", cfg.Key, connURL)
+
+	policy, err := newHttpPolicy(cfg.Routes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("while preparing routes of service %s: %v", cfg.Key, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Composite{
+		Key:           cfg.Key,
+		Endpoint:      cfg.gatewayEndpoint,
+		Connection:    nil,
+		Url:           connURL,
+		ServiceClient: nil,
+		cfg:           cfg,
+		cancel:        cancel,
+	}
+	c.policy.Store(policy)
+
+	if cfg.Manifest != "" {
+		// the service may not be up yet, protection declared in the registry entry applies until
+		// the manifest can be read.
+		c.doRefresh(ctx, "registration")
+
+		if interval := time.Duration(helper.StringToInt(helper.Env(libs.AppHandshakeInterval, "60"), 60)) * time.Second; interval > 0 {
+			go c.watchInterval(ctx, interval)
+		}
+	}
+
+	return c, nil
+}
+
+// newHttpPolicy builds the route policy of an HTTP service. Routes of the registry entry only
+// declare protection, while a manifest describes every route so that it's validated as well.
+func newHttpPolicy(declared []HttpRoute, manifest []HttpRoute) (*routePolicy, error) {
+	lines := []string{}
+	p := &routePolicy{
+		protectedRoutes: make(map[string][]protectedRoute),
+	}
+
+	if manifest != nil {
+		p.routes = []RouteInfo{}
+	}
+
+	add := func(route HttpRoute, isManifest bool) error {
+		method := strings.ToUpper(route.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+
+		switch route.Auth {
+		case "", "protect", "strict", "private":
+
+		default:
+			return fmt.Errorf("unknown auth %s of route %s %s", route.Auth, method, route.Path)
+		}
+
+		rule, params, err := compileTemplate(route.Path)
+		if err != nil {
+			return err
+		}
+
+		if route.Auth != "" {
+			p.protectedRoutes[method] = append(p.protectedRoutes[method], protectedRoute{
+				pattern: rule,
+				method:  route.Auth,
+			})
+		}
+
+		if isManifest {
+			p.routes = append(p.routes, RouteInfo{
+				Method:   method,
+				Template: fmt.Sprintf("/%s", strings.Trim(route.Path, "/")),
+				Params:   params,
+				Auth:     route.Auth,
+				Metas:    map[string]string{},
+				rule:     rule,
+			})
+		}
+
+		lines = append(lines, fmt.Sprintf("route|%t|%s|%s|%s", isManifest, method, route.Path, route.Auth))
+		return nil
+	}
+
+	for _, route := range declared {
+		err := add(route, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, route := range manifest {
+		err := add(route, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(lines)
+	hash := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	p.hash = hex.EncodeToString(hash[:])
+
+	return p, nil
+}
+
+// refreshManifest reads the manifest endpoint of an HTTP service, it's the HTTP counterpart of
+// a handshake.
+func (c *Composite) refreshManifest(ctx context.Context) (bool, error) {
+	c.refresh.Lock()
+	defer c.refresh.Unlock()
+
+	routes, err := c.fetchManifest(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	policy, err := newHttpPolicy(c.cfg.Routes, routes)
+	if err != nil {
+		return false, err
+	}
+
+	if policy.hash == c.currentPolicy().hash {
+		return false, nil
+	}
+
+	c.policy.Store(policy)
+	logger.Infof("route policy of service %s has been refreshed (%s)", c.Key, helper.Sub(policy.hash, 0, 12))
+
+	return true, nil
+}
+
+// fetchManifest accepts either a plain list of routes or a models.Response envelope holding it.
+func (c *Composite) fetchManifest(ctx context.Context) ([]HttpRoute, error) {
+	u := c.Target()
+	u.Path = fmt.Sprintf("/%s", strings.TrimLeft(c.cfg.Manifest, "/"))
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("while preparing manifest request: %v", err)
+	}
+
+	res, err := (&http.Client{Transport: c.Transport()}).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("while reading manifest of service %s: %v", c.Key, err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("while reading manifest of service %s: %v", c.Key, err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("manifest of service %s answered %d", c.Key, res.StatusCode)
+	}
+
+	routes := []HttpRoute{}
+	if body = bytes.TrimSpace(body); bytes.HasPrefix(body, []byte("[")) {
+		err = json.Unmarshal(body, &routes)
+	} else {
+		var envelope struct {
+			Result []HttpRoute `json:"result"`
+		}
+
+		err = json.Unmarshal(body, &envelope)
+		if envelope.Result != nil {
+			routes = envelope.Result
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("while decoding manifest of service %s: %v", c.Key, err)
+	}
+
+	return routes, nil
+}
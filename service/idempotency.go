@@ -0,0 +1,72 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// IdempotencyStore keeps the outcome of requests carrying an Idempotency-Key. Reserve stores the
+// record unless the key is already taken, in which case it returns the record of the key.
+// Complete replaces the record once the request is served, Release frees the key so that the
+// request may be retried.
+type IdempotencyStore interface {
+	Reserve(key string, record []byte, ttl time.Duration) ([]byte, bool, error)
+	Complete(key string, record []byte, ttl time.Duration) error
+	Release(key string) error
+}
+
+// Idempotent is implemented by forwarders honouring Idempotency-Key, UseIdempotencyStore
+// replaces the store they keep the outcomes in.
+type Idempotent interface {
+	UseIdempotencyStore(store IdempotencyStore)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore local to the gateway, retries reaching another
+// replica aren't recognized.
+type MemoryIdempotencyStore struct {
+	mutex   sync.Mutex
+	records map[string]memoryEntry
+	sweep   time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]memoryEntry)}
+}
+
+func (ms *MemoryIdempotencyStore) Reserve(key string, record []byte, ttl time.Duration) ([]byte, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	now := time.Now()
+	if now.After(ms.sweep) {
+		for k, entry := range ms.records {
+			if now.After(entry.expires) {
+				delete(ms.records, k)
+			}
+		}
+		ms.sweep = now.Add(time.Minute)
+	}
+
+	if entry, ok := ms.records[key]; ok && now.Before(entry.expires) {
+		return entry.value, false, nil
+	}
+
+	ms.records[key] = memoryEntry{record, now.Add(ttl)}
+	return nil, true, nil
+}
+
+func (ms *MemoryIdempotencyStore) Complete(key string, record []byte, ttl time.Duration) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.records[key] = memoryEntry{record, time.Now().Add(ttl)}
+	return nil
+}
+
+func (ms *MemoryIdempotencyStore) Release(key string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	delete(ms.records, key)
+	return nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/uzzeet/uzzeet-gateway/packets"
+)
+
+type RouteInfo struct {
+	Method   string            `json:"method"`
+	Template string            `json:"template"`
+	Params   []string          `json:"params"`
+	Auth     string            `json:"auth"`
+	Metas    map[string]string `json:"metas"`
+	rule     *regexp.Regexp
+}
+
+func newRouteInfos(routes []*packets.RouteManifest) ([]RouteInfo, error) {
+	res := []RouteInfo{}
+	for _, route := range routes {
+		rule, err := regexp.Compile(route.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("while compiling route %s %s: %v", route.Method, route.Template, err)
+		}
+
+		res = append(res, RouteInfo{
+			Method:   route.Method,
+			Template: route.Template,
+			Params:   route.Params,
+			Auth:     route.Auth,
+			Metas:    route.Metas,
+			rule:     rule,
+		})
+	}
+
+	return res, nil
+}
+
+// HasManifest tells whether the service published its full route manifest during handshake.
+func (c *Composite) HasManifest() bool {
+	return c.currentPolicy().routes != nil
+}
+
+func (c *Composite) Manifest() []RouteInfo {
+	return c.currentPolicy().routes
+}
+
+// Route looks up the route template serving the given request. When nothing matches, the methods
+// accepting the path are returned instead, an empty list means the path doesn't exist at all.
+func (c *Composite) Route(method string, path string) (*RouteInfo, []string) {
+	routes := c.currentPolicy().routes
+
+	allowed := []string{}
+	for i, route := range routes {
+		if !route.rule.MatchString(path) {
+			continue
+		}
+
+		if route.Method == method {
+			return &routes[i], nil
+		}
+
+		allowed = append(allowed, route.Method)
+	}
+
+	sort.Strings(allowed)
+	return nil, allowed
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"strings"
+)
+
+// ServiceNames lists the fully qualified gRPC services owned by the composite, either declared
+// explicitly or referenced by one of its transcoding bindings.
+func (c *Composite) ServiceNames() []string {
+	if c.Connection == nil {
+		return nil
+	}
+
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, each := range c.cfg.Services {
+		if !seen[each.Name] {
+			seen[each.Name] = true
+			names = append(names, each.Name)
+		}
+	}
+
+	if c.transcoder != nil {
+		for _, each := range c.transcoder.bindings {
+			name := strings.Split(strings.Trim(each.fullMethod, "/"), "/")[0]
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// MethodAuth returns the protection method ("protect", "strict", "private" or empty) of a full
+// gRPC method name such as /packets.Devices/CreateDevice.
+func (c *Composite) MethodAuth(fullMethod string) string {
+	tokens := strings.Split(strings.Trim(fullMethod, "/"), "/")
+	if len(tokens) != 2 {
+		return ""
+	}
+
+	for _, each := range c.cfg.Services {
+		if each.Name != tokens[0] {
+			continue
+		}
+
+		if auth, ok := each.Methods[tokens[1]]; ok {
+			return auth
+		}
+
+		return each.Auth
+	}
+
+	if c.transcoder != nil {
+		for _, each := range c.transcoder.bindings {
+			if each.fullMethod == "/"+strings.Join(tokens, "/") && each.Auth != "" {
+				return each.Auth
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	QuotaByApp          = "app"
+	QuotaByOrganization = "org"
+)
+
+// Quota bounds the requests an application or an organization makes per day and per month, a
+// zero bound is unlimited. Requests are metered once authorized, by the app and organization of
+// their token.
+type Quota struct {
+	By      string `json:"by"`
+	ID      string `json:"id"`
+	Daily   int64  `json:"daily,omitempty"`
+	Monthly int64  `json:"monthly,omitempty"`
+}
+
+// Usage is the number of requests a subject made in a day and a month, days are formatted
+// 2006-01-02 and months 2006-01.
+type Usage struct {
+	Subject string `json:"subject"`
+	Day     string `json:"day"`
+	Daily   int64  `json:"daily"`
+	Month   string `json:"month"`
+	Monthly int64  `json:"monthly"`
+}
+
+// QuotaReader is implemented by registries storing quotas, a quota without bounds removes the
+// one of the same subject.
+type QuotaReader interface {
+	GetQuotas() ([]Quota, error)
+	WatchQuotas() (<-chan Quota, error)
+}
+
+type QuotaWriter interface {
+	WriteQuota(Quota) error
+}
+
+// QuotaEnforcer is implemented by forwarders metering requests against quotas.
+type QuotaEnforcer interface {
+	Quota(Quota) error
+}
+
+// UsageMeter counts the requests of the subjects. Consume counts a request against every quota
+// unless it exceeds one of them, it returns the usage of each subject along with whether the
+// request was counted.
+type UsageMeter interface {
+	Consume(quotas []Quota, day string, month string) ([]Usage, bool, error)
+	Usage(subject string, day string, month string) (Usage, error)
+	ResetUsage(subject string, day string, month string) error
+}
+
+// UsageMetered is implemented by forwarders metering requests, UseUsageMeter replaces the meter
+// they count requests with.
+type UsageMetered interface {
+	UseUsageMeter(meter UsageMeter)
+}
+
+// Subject identifies the app or organization the quota applies to, e.g. app:42.
+func (q Quota) Subject() string {
+	return q.By + ":" + q.ID
+}
+
+func (q Quota) IsActive() bool {
+	return q.Daily > 0 || q.Monthly > 0
+}
+
+// IsExceeded tells whether the usage leaves no room for another request.
+func (q Quota) IsExceeded(usage Usage) bool {
+	return (q.Daily > 0 && usage.Daily >= q.Daily) || (q.Monthly > 0 && usage.Monthly >= q.Monthly)
+}
+
+func (q Quota) Validate() error {
+	switch q.By {
+	case QuotaByApp, QuotaByOrganization:
+
+	default:
+		return fmt.Errorf("unknown quota subject %s", q.By)
+	}
+
+	if q.ID == "" {
+		return errors.New("quota needs an id")
+	}
+
+	if q.Daily < 0 || q.Monthly < 0 {
+		return fmt.Errorf("bounds of quota %s can't be negative", q.Subject())
+	}
+
+	return nil
+}
+
+// MemoryUsageMeter is a UsageMeter local to the gateway, it only keeps the current day and month
+// of each subject.
+type MemoryUsageMeter struct {
+	mutex  sync.Mutex
+	usages map[string]*Usage
+}
+
+func NewMemoryUsageMeter() *MemoryUsageMeter {
+	return &MemoryUsageMeter{usages: make(map[string]*Usage)}
+}
+
+func (mm *MemoryUsageMeter) Consume(quotas []Quota, day string, month string) ([]Usage, bool, error) {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	usages := make([]*Usage, len(quotas))
+	allowed := true
+	for i, quota := range quotas {
+		usages[i] = mm.current(quota.Subject(), day, month)
+		if quota.IsExceeded(*usages[i]) {
+			allowed = false
+		}
+	}
+
+	res := make([]Usage, len(quotas))
+	for i, usage := range usages {
+		if allowed {
+			usage.Daily++
+			usage.Monthly++
+		}
+
+		res[i] = *usage
+	}
+
+	return res, allowed, nil
+}
+
+func (mm *MemoryUsageMeter) Usage(subject string, day string, month string) (Usage, error) {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	usage, ok := mm.usages[subject]
+	if !ok {
+		return Usage{Subject: subject, Day: day, Month: month}, nil
+	}
+
+	res := Usage{Subject: subject, Day: day, Month: month}
+	if usage.Day == day {
+		res.Daily = usage.Daily
+	}
+
+	if usage.Month == month {
+		res.Monthly = usage.Monthly
+	}
+
+	return res, nil
+}
+
+func (mm *MemoryUsageMeter) ResetUsage(subject string, day string, month string) error {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	usage, ok := mm.usages[subject]
+	if !ok {
+		return nil
+	}
+
+	if usage.Day == day {
+		usage.Daily = 0
+	}
+
+	if usage.Month == month {
+		usage.Monthly = 0
+	}
+
+	return nil
+}
+
+// current returns the usage of the subject, reset when its day or month is over.
+func (mm *MemoryUsageMeter) current(subject string, day string, month string) *Usage {
+	usage, ok := mm.usages[subject]
+	if !ok {
+		usage = &Usage{Subject: subject, Day: day, Month: month}
+		mm.usages[subject] = usage
+	}
+
+	if usage.Day != day {
+		usage.Day, usage.Daily = day, 0
+	}
+
+	if usage.Month != month {
+		usage.Month, usage.Monthly = month, 0
+	}
+
+	return usage
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestMemoryUsageMeterConsume(t *testing.T) {
+	quotas := []Quota{
+		{By: QuotaByApp, ID: "42", Daily: 2},
+		{By: QuotaByOrganization, ID: "7", Monthly: 3},
+	}
+
+	meter := NewMemoryUsageMeter()
+	steps := []struct {
+		name    string
+		day     string
+		month   string
+		allowed bool
+		daily   [2]int64
+		monthly [2]int64
+	}{
+		{"first request", "2026-10-01", "2026-10", true, [2]int64{1, 1}, [2]int64{1, 1}},
+		{"second request", "2026-10-01", "2026-10", true, [2]int64{2, 2}, [2]int64{2, 2}},
+		{"app over its daily quota", "2026-10-01", "2026-10", false, [2]int64{2, 2}, [2]int64{2, 2}},
+		{"next day", "2026-10-02", "2026-10", true, [2]int64{1, 1}, [2]int64{3, 3}},
+		{"organization over its monthly quota", "2026-10-02", "2026-10", false, [2]int64{1, 1}, [2]int64{3, 3}},
+		{"next month", "2026-11-01", "2026-11", true, [2]int64{1, 1}, [2]int64{1, 1}},
+	}
+
+	for _, step := range steps {
+		usages, allowed, err := meter.Consume(quotas, step.day, step.month)
+		if err != nil {
+			t.Fatalf("%s: Consume() error = %v", step.name, err)
+		}
+
+		if allowed != step.allowed {
+			t.Errorf("%s: Consume() allowed = %v, want %v", step.name, allowed, step.allowed)
+		}
+
+		for i, usage := range usages {
+			if usage.Subject != quotas[i].Subject() || usage.Daily != step.daily[i] || usage.Monthly != step.monthly[i] {
+				t.Errorf("%s: usage of %s = %+v, want %d daily and %d monthly", step.name, quotas[i].Subject(), usage, step.daily[i], step.monthly[i])
+			}
+		}
+	}
+}
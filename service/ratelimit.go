@@ -0,0 +1,298 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitByIP           = "ip"
+	RateLimitByClient       = "client"
+	RateLimitByUser         = "user"
+	RateLimitByOrganization = "org"
+
+	RateLimitSlidingWindow = "sliding_window"
+	RateLimitTokenBucket   = "token_bucket"
+)
+
+// RateLimit allows Limit requests per Window seconds to each client, identified by its IP, its
+// composite ID once its signature is verified, its user or its organization. Limits with a path only apply to the matching
+// routes, limits without a method apply to every method. Token buckets hold up to Burst tokens,
+// Limit by default, refilled at Limit per Window.
+type RateLimit struct {
+	Name      string `json:"name,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Path      string `json:"path,omitempty"`
+	By        string `json:"by"`
+	Limit     int    `json:"limit"`
+	Window    int    `json:"window"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Burst     int    `json:"burst,omitempty"`
+}
+
+// RateLimitResult is the state of a limit once a request is counted. Allowed is whether the limit
+// admits the request, Reset is when the client gets its whole limit back and RetryAfter is when a
+// rejected request may be retried.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimiter counts the requests of a client against limits, each key identifies the client and
+// one of the limits. A request is counted against every limit when they all admit it and against
+// none of them otherwise.
+type RateLimiter interface {
+	Allow(keys []string, limits []RateLimit) ([]RateLimitResult, error)
+}
+
+// RateLimited is implemented by forwarders applying rate limits, UseRateLimiter replaces the
+// limiter they count requests with.
+type RateLimited interface {
+	UseRateLimiter(limiter RateLimiter)
+}
+
+type rateLimit struct {
+	RateLimit
+	rule *regexp.Regexp
+}
+
+func newRateLimits(limits []RateLimit) ([]rateLimit, error) {
+	res := []rateLimit{}
+	for i, each := range limits {
+		switch each.By {
+		case RateLimitByIP, RateLimitByClient, RateLimitByUser, RateLimitByOrganization:
+
+		default:
+			return nil, fmt.Errorf("unknown rate limit key %s", each.By)
+		}
+
+		switch each.Algorithm {
+		case "":
+			each.Algorithm = RateLimitSlidingWindow
+
+		case RateLimitSlidingWindow, RateLimitTokenBucket:
+
+		default:
+			return nil, fmt.Errorf("unknown rate limit algorithm %s", each.Algorithm)
+		}
+
+		if each.Limit <= 0 || each.Window <= 0 {
+			return nil, errors.New("rate limits need a positive limit and window")
+		}
+
+		if each.Burst <= 0 {
+			each.Burst = each.Limit
+		}
+
+		if each.Name == "" {
+			each.Name = fmt.Sprintf("%d", i)
+		}
+		each.Method = strings.ToUpper(each.Method)
+
+		limit := rateLimit{each, nil}
+		if each.Path != "" {
+			rule, _, err := compileTemplate(each.Path)
+			if err != nil {
+				return nil, fmt.Errorf("while compiling rate limit %s: %v", each.Path, err)
+			}
+
+			limit.rule = rule
+		}
+
+		res = append(res, limit)
+	}
+
+	return res, nil
+}
+
+// RateLimits returns the limits applying to the route.
+func (c *Composite) RateLimits(method string, path string) []RateLimit {
+	res := []RateLimit{}
+	for _, each := range c.rateLimits {
+		if each.Method != "" && each.Method != method {
+			continue
+		}
+
+		if each.rule != nil && !each.rule.MatchString(path) {
+			continue
+		}
+
+		res = append(res, each.RateLimit)
+	}
+
+	return res
+}
+
+type rateLimitState struct {
+	// sliding windows count the requests of the current and previous windows, token buckets
+	// keep their tokens in current.
+	window   int64
+	current  float64
+	previous float64
+	updated  time.Time
+	expires  time.Time
+}
+
+// MemoryRateLimiter is a RateLimiter local to the gateway, limits aren't shared with other
+// replicas.
+type MemoryRateLimiter struct {
+	mutex  sync.Mutex
+	states map[string]*rateLimitState
+	sweep  time.Time
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{states: make(map[string]*rateLimitState)}
+}
+
+func (ml *MemoryRateLimiter) Allow(keys []string, limits []RateLimit) ([]RateLimitResult, error) {
+	if len(keys) != len(limits) {
+		return nil, errors.New("rate limits need a key each")
+	}
+
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+
+	now := time.Now()
+	if now.After(ml.sweep) {
+		for k, state := range ml.states {
+			if now.After(state.expires) {
+				delete(ml.states, k)
+			}
+		}
+		ml.sweep = now.Add(time.Minute)
+	}
+
+	states := make([]*rateLimitState, len(limits))
+	admitted := make([]bool, len(limits))
+	allowed := true
+	for i, limit := range limits {
+		state, ok := ml.states[keys[i]]
+		if !ok {
+			state = &rateLimitState{updated: now}
+			if limit.Algorithm == RateLimitTokenBucket {
+				state.current = float64(limit.Burst)
+			}
+			ml.states[keys[i]] = state
+		}
+
+		window := time.Duration(limit.Window) * time.Second
+		if limit.Algorithm == RateLimitTokenBucket {
+			admitted[i] = state.refill(limit, window, now)
+		} else {
+			admitted[i] = state.slide(limit, window, now)
+		}
+
+		states[i] = state
+		allowed = allowed && admitted[i]
+	}
+
+	res := make([]RateLimitResult, len(limits))
+	for i, limit := range limits {
+		state := states[i]
+		if limit.Algorithm == RateLimitTokenBucket {
+			if allowed {
+				state.current--
+			}
+
+			res[i] = NewTokenBucketResult(limit, admitted[i], state.current)
+			state.expires = now.Add(res[i].Reset + time.Second)
+			continue
+		}
+
+		if allowed {
+			state.current++
+		}
+
+		elapsed := time.Duration(now.UnixNano() % (int64(limit.Window) * int64(time.Second)))
+		res[i] = NewSlidingWindowResult(limit, admitted[i], state.previous, state.current, elapsed)
+		state.expires = now.Add(res[i].Reset)
+	}
+
+	return res, nil
+}
+
+// refill adds the tokens earned since the bucket was last used, it returns whether a token is left.
+func (state *rateLimitState) refill(limit RateLimit, window time.Duration, now time.Time) bool {
+	rate := float64(limit.Limit) / window.Seconds()
+	state.current = math.Min(float64(limit.Burst), state.current+now.Sub(state.updated).Seconds()*rate)
+	state.updated = now
+
+	return state.current >= 1
+}
+
+// slide moves the window to the current time, it returns whether one more request fits.
+func (state *rateLimitState) slide(limit RateLimit, window time.Duration, now time.Time) bool {
+	index := now.UnixNano() / int64(window)
+	switch {
+	case index == state.window+1:
+		state.previous, state.current = state.current, 0
+
+	case index != state.window:
+		state.previous, state.current = 0, 0
+	}
+	state.window = index
+
+	elapsed := time.Duration(now.UnixNano() % int64(window))
+	return state.previous*(1-float64(elapsed)/float64(window))+state.current+1 <= float64(limit.Limit)
+}
+
+// NewTokenBucketResult is the state of a token bucket left with the given tokens.
+func NewTokenBucketResult(limit RateLimit, allowed bool, tokens float64) RateLimitResult {
+	rate := float64(limit.Limit) / float64(limit.Window)
+
+	res := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(tokens),
+		Reset:     seconds((float64(limit.Burst) - tokens) / rate),
+	}
+
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+
+	return res
+}
+
+// NewSlidingWindowResult is the state of a sliding window with the given counts of requests in
+// the previous and current windows, elapsed is the time spent in the current window.
+func NewSlidingWindowResult(limit RateLimit, allowed bool, previous float64, current float64, elapsed time.Duration) RateLimitResult {
+	window := time.Duration(limit.Window) * time.Second
+	count := previous*(1-float64(elapsed)/float64(window)) + current
+
+	res := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Limit,
+		Remaining: int(math.Max(0, float64(limit.Limit)-count)),
+		Reset:     2*window - elapsed,
+	}
+
+	if !allowed {
+		res.RetryAfter = slidingRetry(previous, current, float64(limit.Limit), elapsed, window)
+	}
+
+	return res
+}
+
+// slidingRetry is when the weighted count of a sliding window leaves room for one more request,
+// either later in the current window or once the current window becomes the previous one.
+func slidingRetry(previous float64, current float64, limit float64, elapsed time.Duration, window time.Duration) time.Duration {
+	if current+1 <= limit && previous > 0 {
+		return time.Duration(float64(window)*(1-(limit-current-1)/previous)) - elapsed
+	}
+
+	return window - elapsed + time.Duration(float64(window)*math.Max(0, 1-(limit-1)/current))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
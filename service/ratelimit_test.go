@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingRetry(t *testing.T) {
+	window := 10 * time.Second
+
+	tests := []struct {
+		name     string
+		previous float64
+		current  float64
+		limit    float64
+		elapsed  time.Duration
+		want     time.Duration
+	}{
+		{"previous window decays", 10, 5, 10, 5 * time.Second, time.Second},
+		{"current window is full", 0, 10, 10, 2 * time.Second, 9 * time.Second},
+		{"both windows are full", 5, 10, 10, 2 * time.Second, 9 * time.Second},
+		{"single request limit", 0, 1, 1, 0, 2 * window},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slidingRetry(tt.previous, tt.current, tt.limit, tt.elapsed, window)
+			if diff := got - tt.want; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("slidingRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTokenBucketResult(t *testing.T) {
+	limit := RateLimit{Limit: 10, Window: 10, Burst: 20, Algorithm: RateLimitTokenBucket}
+
+	tests := []struct {
+		name    string
+		allowed bool
+		tokens  float64
+		want    RateLimitResult
+	}{
+		{"full bucket", true, 20, RateLimitResult{Allowed: true, Limit: 20, Remaining: 20}},
+		{"partial bucket", true, 5, RateLimitResult{Allowed: true, Limit: 20, Remaining: 5, Reset: 15 * time.Second}},
+		{"empty bucket", false, 0.5, RateLimitResult{Limit: 20, Remaining: 0, Reset: 19500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewTokenBucketResult(limit, tt.allowed, tt.tokens)
+			if got != tt.want {
+				t.Errorf("NewTokenBucketResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type rewrite struct {
+	Rewrite
+	rule *regexp.Regexp
+}
+
+func newRewrites(rules []Rewrite) ([]rewrite, error) {
+	res := []rewrite{}
+	for _, each := range rules {
+		switch {
+		case each.Regex != "" && each.Prefix != "":
+			return nil, errors.New("a rewrite can't have both prefix and regex")
+
+		case each.Regex != "":
+			rule, err := regexp.Compile(each.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("while compiling rewrite %s: %v", each.Regex, err)
+			}
+
+			res = append(res, rewrite{each, rule})
+
+		case each.Prefix != "":
+			each.Prefix = "/" + strings.Trim(each.Prefix, "/")
+			res = append(res, rewrite{each, nil})
+
+		default:
+			return nil, errors.New("a rewrite needs either prefix or regex")
+		}
+	}
+
+	return res, nil
+}
+
+func (r rewrite) apply(path string) string {
+	if r.rule != nil {
+		return r.rule.ReplaceAllString(path, r.Replace)
+	}
+
+	if path != r.Prefix && !strings.HasPrefix(path, r.Prefix+"/") {
+		return path
+	}
+
+	return strings.TrimRight(r.Replace, "/") + strings.TrimPrefix(path, r.Prefix)
+}
+
+// Rewrite applies the rewrite rules of the service, in order, to the path the service receives.
+func (c *Composite) Rewrite(path string) string {
+	for _, each := range c.rewrites {
+		path = each.apply(path)
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return path
+}
+
+// Version is the API version served by the composite, e.g. v2. It's empty for unversioned services.
+func (c *Composite) Version() string {
+	return NormalizeVersion(c.cfg.Version)
+}
+
+// NormalizeVersion makes 2, V2 and v2 the same version.
+func NormalizeVersion(version string) string {
+	version = strings.ToLower(strings.TrimSpace(version))
+	if version != "" && version[0] >= '0' && version[0] <= '9' {
+		version = "v" + version
+	}
+
+	return version
+}
+
+// CompareVersion orders versions such as v1, v1.2 and v10 numerically.
+func CompareVersion(a string, b string) int {
+	as := strings.Split(strings.TrimPrefix(NormalizeVersion(a), "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(NormalizeVersion(b), "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+
+		if i < len(bs) {
+			y = bs[i]
+		}
+
+		xn, errx := strconv.Atoi(x)
+		yn, erry := strconv.Atoi(y)
+		switch {
+		case errx == nil && erry == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+
+			return 1
+
+		case (errx != nil || erry != nil) && x != y:
+			return strings.Compare(x, y)
+		}
+	}
+
+	return 0
+}
@@ -8,9 +8,11 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/uzzeet/uzzeet-gateway/libs/helper/serror"
+	"github.com/uzzeet/uzzeet-gateway/packets"
 )
 
 type HandlerFunc func(ctx *Context) Result
@@ -28,10 +30,18 @@ type router struct {
 }
 
 type Route struct {
-	method  string
-	params  []string
-	handler HandlerFunc
-	rule    *regexp.Regexp
+	method   string
+	template string
+	params   []string
+	metas    map[string]string
+	handler  HandlerFunc
+	rule     *regexp.Regexp
+}
+
+// Meta attaches a metadata entry to the route, it is published to the gateway within the route manifest.
+func (r Route) Meta(key, value string) Route {
+	r.metas[key] = value
+	return r
 }
 
 func (svc *Service) GET(path string, handler HandlerFunc) Route {
@@ -114,14 +124,14 @@ func (svc *Service) WithMiddleware(handler HandlerFunc, mws ...Middleware) Handl
 	return handler
 }
 
-func (r *router) register(method string, pattern string, handlerFn HandlerFunc) Route {
+func compileTemplate(pattern string) (*regexp.Regexp, []string, error) {
 	var params []string
 
 	tpl := strings.Trim(pattern, "/")
 	for opener := strings.Index(tpl, "{"); opener != -1; opener = strings.Index(tpl, "{") {
 		closer := strings.Index(tpl, "}")
 		if closer == -1 {
-			panic(errors.New("} doesn't exist"))
+			return nil, nil, errors.New("} doesn't exist")
 		}
 
 		params = append(params, tpl[opener+1:closer])
@@ -132,7 +142,16 @@ func (r *router) register(method string, pattern string, handlerFn HandlerFunc)
 	tpl = fmt.Sprintf("^/?%s/??$", tpl)
 	rule, err := regexp.Compile(tpl)
 	if err != nil {
-		panic(fmt.Errorf("while compiling regex rule: %v", err))
+		return nil, nil, fmt.Errorf("while compiling regex rule: %v", err)
+	}
+
+	return rule, params, nil
+}
+
+func (r *router) register(method string, pattern string, handlerFn HandlerFunc) Route {
+	rule, params, err := compileTemplate(pattern)
+	if err != nil {
+		panic(err)
 	}
 
 	for _, route := range r.routes[method] {
@@ -142,16 +161,57 @@ func (r *router) register(method string, pattern string, handlerFn HandlerFunc)
 	}
 
 	route := Route{
-		method:  method,
-		params:  params,
-		handler: handlerFn,
-		rule:    rule,
+		method:   method,
+		template: fmt.Sprintf("/%s", strings.Trim(pattern, "/")),
+		params:   params,
+		metas:    make(map[string]string),
+		handler:  handlerFn,
+		rule:     rule,
 	}
 	r.routes[method] = append(r.routes[method], route)
 
 	return route
 }
 
+func (r router) authOf(route Route) string {
+	for _, each := range r.protectedRoutes[route.method] {
+		if each.pattern.String() == route.rule.String() {
+			return each.method
+		}
+	}
+
+	return ""
+}
+
+func (r router) manifest() []*packets.RouteManifest {
+	methods := []string{}
+	for method := range r.routes {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	res := []*packets.RouteManifest{}
+	for _, method := range methods {
+		for _, route := range r.routes[method] {
+			metas := make(map[string]string)
+			for k, v := range route.metas {
+				metas[k] = v
+			}
+
+			res = append(res, &packets.RouteManifest{
+				Method:   route.method,
+				Template: route.template,
+				Pattern:  route.rule.String(),
+				Params:   route.params,
+				Auth:     r.authOf(route),
+				Metas:    metas,
+			})
+		}
+	}
+
+	return res
+}
+
 func (r router) route(ctx *Context) Result {
 	for _, each := range r.routes[ctx.requestContext.method] {
 		if each.rule.Match([]byte(ctx.requestContext.path)) {
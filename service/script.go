@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+)
+
+// Script is a policy script stored in the registry, services run it through the script filter.
+// A script without source is removed.
+type Script struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+}
+
+// ScriptReader is implemented by registries storing policy scripts.
+type ScriptReader interface {
+	GetScripts() ([]Script, error)
+	WatchScripts() (<-chan Script, error)
+}
+
+type ScriptWriter interface {
+	WriteScript(Script) error
+}
+
+// ScriptLoader is implemented by forwarders able to run policy scripts, a loaded script replaces
+// the one with the same name for the next requests.
+type ScriptLoader interface {
+	LoadScript(Script) error
+}
+
+func (s Script) Validate() error {
+	if s.Name == "" {
+		return errors.New("script needs a name")
+	}
+
+	return nil
+}
+
+// IsActive tells whether the script has to be loaded rather than removed.
+func (s Script) IsActive() bool {
+	return s.Source != ""
+}
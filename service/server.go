@@ -9,6 +9,8 @@ import (
 	"github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
 	"go.elastic.co/apm/module/apmgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	"github.com/uzzeet/uzzeet-gateway/packets"
 )
@@ -22,7 +24,7 @@ type Server struct {
 }
 
 func NewServer(cfg Config, reg RegistryWriter) (*Server, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	listener, err := listen(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("while opening listener: %v", err)
 	}
@@ -46,10 +48,16 @@ func NewServerHttp(cfg Config, reg RegistryWriter) (*Server, error) {
 func (svr *Server) AsGatewayService(baseEndpoint string) *Service {
 	svr.cfg.gatewayEndpoint = baseEndpoint
 	svc := &Service{
-		key:          helper.Env(libs.AppName, libs.AppName),
-		namespace:    helper.Env(libs.AppNamespace, libs.NamespaceDefault),
-		baseEndpoint: baseEndpoint,
-		checksum:     svr.cfg.checksum(),
+		key:            helper.Env(libs.AppName, libs.AppName),
+		namespace:      helper.Env(libs.AppNamespace, libs.NamespaceDefault),
+		baseEndpoint:   baseEndpoint,
+		checksum:       svr.cfg.checksum(),
+		identitySecret: helper.Env(libs.AppIdentitySecret, ""),
+		capabilities: []string{
+			CapabilityCompression,
+			CapabilityHealth,
+			CapabilityRouteManifest,
+		},
 		router: router{
 			routes:          make(map[string][]Route),
 			protectedRoutes: make(map[string][]protectedRoute),
@@ -57,6 +65,7 @@ func (svr *Server) AsGatewayService(baseEndpoint string) *Service {
 	}
 
 	packets.RegisterServiceServer(svr.instance, svc)
+	healthpb.RegisterHealthServer(svr.instance, health.NewServer())
 
 	return svc
 }
@@ -79,7 +88,7 @@ func (svr Server) Start() error {
 		}
 	}
 
-	logger.Infof("service is listening on %s.", fmt.Sprintf("%s:%d", svr.cfg.Host, svr.cfg.Port))
+	logger.Infof("service is listening on %s.", svr.cfg.Address())
 	return svr.instance.Serve(svr.listener)
 }
 
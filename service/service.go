@@ -15,11 +15,13 @@ import (
 )
 
 type Service struct {
-	key          string
-	namespace    string
-	baseEndpoint string
-	checksum     string
-	router       router
+	key            string
+	namespace      string
+	baseEndpoint   string
+	checksum       string
+	identitySecret string
+	capabilities   []string
+	router         router
 }
 
 func (svc Service) BaseEndpoint() string {
@@ -30,8 +32,31 @@ func (svc Service) Key() string {
 	return svc.key
 }
 
+// Advertise declares additional capabilities this service supports on top of the built-in ones.
+func (svc *Service) Advertise(capabilities ...string) {
+	for _, each := range capabilities {
+		if !svc.Protocol().Supports(each) {
+			svc.capabilities = append(svc.capabilities, each)
+		}
+	}
+}
+
+func (svc Service) Protocol() Protocol {
+	capabilities := append([]string{}, svc.capabilities...)
+	if svc.identitySecret != "" {
+		capabilities = append(capabilities, CapabilitySignedIdentity)
+	}
+
+	return Protocol{
+		Version:      ProtocolVersion,
+		Capabilities: capabilities,
+	}
+}
+
 func (svc Service) Handshake(ctx context.Context, ackr *packets.AckRequest) (*packets.Ack, error) {
-	logger.Infof("retrive incoming handshake from gateway(%s)", ackr.From)
+	protocol := svc.Protocol()
+	negotiated := negotiateProtocol(ackr.Version, protocol.Capabilities, ackr.Capabilities)
+	logger.Infof("retrive incoming handshake from gateway(%s), protocol v%d %v", ackr.From, negotiated.Version, negotiated.Capabilities)
 
 	pr := make(map[string]*packets.ProtectedRoutes)
 	for method, routes := range svc.router.protectedRoutes {
@@ -53,18 +78,28 @@ func (svc Service) Handshake(ctx context.Context, ackr *packets.AckRequest) (*pa
 		host = "?"
 	}
 
-	return &packets.Ack{
+	ack := &packets.Ack{
 		Server:          host,
 		Checksum:        svc.checksum,
 		Namespace:       svc.namespace,
 		ProtectedRoutes: pr,
-	}, nil
+		Version:         protocol.Version,
+		Capabilities:    protocol.Capabilities,
+	}
+
+	if negotiated.Supports(CapabilityRouteManifest) {
+		ack.Routes = svc.router.manifest()
+	}
+
+	return ack, nil
 }
 
 func (svc Service) Dispatch(ctx context.Context, req *packets.Request) (*packets.Response, error) {
 	var (
-		clientInfo models.ClientInfo
-		authInfo   models.AuthorizationInfo
+		clientInfo    models.ClientInfo
+		authInfo      models.AuthorizationInfo
+		rawAuthInfo   string
+		authSignature string
 	)
 
 	header := make(map[string]string)
@@ -86,6 +121,12 @@ func (svc Service) Dispatch(ctx context.Context, req *packets.Request) (*packets
 					return nil, err
 				}
 
+				rawAuthInfo = vals[0]
+				continue
+			}
+
+			if http.CanonicalHeaderKey(key) == http.CanonicalHeaderKey(models.AuthorizationSignatureValueKey) {
+				authSignature = vals[0]
 				continue
 			}
 
@@ -93,27 +134,31 @@ func (svc Service) Dispatch(ctx context.Context, req *packets.Request) (*packets
 		}
 	}
 
+	if svc.identitySecret != "" && rawAuthInfo != "" && !verifyIdentity(svc.identitySecret, rawAuthInfo, authSignature) {
+		logger.Warnf("rejecting request %s %s, authorization info signature mismatch", req.Method, req.Path)
+		return responseContext{header: make(map[string]string)}.JSONResponse(http.StatusUnauthorized, models.ResponseBody{
+			Error:      "Identitas tidak valid",
+			Controller: req.Path,
+			Action:     req.Method,
+		}).buildResponse(ctx)
+	}
+
 	u, err := url.Parse(req.Path)
 	if err != nil {
-		return Context{}.JSONResponse(http.StatusBadRequest, models.ResponseBody{
+		return responseContext{header: make(map[string]string)}.JSONResponse(http.StatusBadRequest, models.ResponseBody{
 			Error:      "Jalur tidak ditemukan",
 			Controller: req.Path,
 			Action:     req.Method,
 		}).buildResponse(ctx)
 	}
 
-	query := make(map[string]string)
-	for key, vals := range u.Query() {
-		query[key] = vals[0]
-	}
-
 	sCtx := &Context{
 		requestContext{
 			path:       u.Path,
 			method:     req.Method,
 			body:       req.Body,
 			header:     header,
-			query:      query,
+			query:      u.Query(),
 			params:     make(map[string]string),
 			authInfo:   authInfo,
 			clientInfo: clientInfo,
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"google.golang.org/grpc"
+
+	"github.com/uzzeet/uzzeet-gateway/controller/resolver"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+)
+
+// IsUnix tells whether the service listens on a unix domain socket instead of a TCP port.
+func (cfg Config) IsUnix() bool {
+	return cfg.Socket != ""
+}
+
+// Address describes where the service listens, for logging purpose.
+func (cfg Config) Address() string {
+	if cfg.IsUnix() {
+		return fmt.Sprintf("unix:%s", cfg.Socket)
+	}
+
+	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+}
+
+// DialTarget returns the gRPC target of the service. Services on a unix socket don't go through
+// the resolver, they're reached by the dialer of DialOptions.
+func (cfg Config) DialTarget(resolv resolver.Resolver) string {
+	if cfg.IsUnix() {
+		return cfg.Address()
+	}
+
+	return resolv.GenerateURL(cfg.Host, helper.IntToString(cfg.Port))
+}
+
+// DialOptions returns the extra options needed to dial the service.
+func (cfg Config) DialOptions() []grpc.DialOption {
+	if !cfg.IsUnix() {
+		return nil
+	}
+
+	return []grpc.DialOption{
+		grpc.WithContextDialer(cfg.dialUnix),
+	}
+}
+
+func (cfg Config) dialUnix(ctx context.Context, _ string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", cfg.Socket)
+}
+
+func listen(cfg Config) (net.Listener, error) {
+	if !cfg.IsUnix() {
+		return net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	}
+
+	// a socket left behind by a previous run would make listen fail.
+	if info, err := os.Stat(cfg.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		err := os.Remove(cfg.Socket)
+		if err != nil {
+			return nil, fmt.Errorf("while removing stale socket %s: %v", cfg.Socket, err)
+		}
+	}
+
+	return net.Listen("unix", cfg.Socket)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	CohortUser         = "user"
+	CohortOrganization = "org"
+)
+
+// TrafficPolicy splits the traffic of the Stable composite with the Canary one. Requests carrying
+// Header (or Cookie) with the expected value always reach the canary, the others are split by
+// Weight, a percentage, either at random or per user/organization when Cohort is set so that a
+// given user keeps hitting the same composite.
+type TrafficPolicy struct {
+	Stable      string `json:"stable"`
+	Canary      string `json:"canary"`
+	Weight      int    `json:"weight"`
+	Header      string `json:"header,omitempty"`
+	HeaderValue string `json:"header_value,omitempty"`
+	Cookie      string `json:"cookie,omitempty"`
+	CookieValue string `json:"cookie_value,omitempty"`
+	Cohort      string `json:"cohort,omitempty"`
+}
+
+// TrafficReader is implemented by registries storing traffic policies, they're keyed by the stable
+// composite. A policy without canary removes the split.
+type TrafficReader interface {
+	GetTraffic() ([]TrafficPolicy, error)
+	WatchTraffic() (<-chan TrafficPolicy, error)
+}
+
+type TrafficWriter interface {
+	WriteTraffic(TrafficPolicy) error
+}
+
+// TrafficSplitter is implemented by forwarders able to split traffic between composites.
+type TrafficSplitter interface {
+	Split(TrafficPolicy)
+}
+
+func (p TrafficPolicy) Validate() error {
+	if p.Stable == "" {
+		return errors.New("traffic policy needs a stable service")
+	}
+
+	if p.Stable == p.Canary {
+		return fmt.Errorf("service %s can't be its own canary", p.Stable)
+	}
+
+	if p.Weight < 0 || p.Weight > 100 {
+		return fmt.Errorf("weight of service %s must be between 0 and 100", p.Stable)
+	}
+
+	switch p.Cohort {
+	case "", CohortUser, CohortOrganization:
+
+	default:
+		return fmt.Errorf("unknown cohort %s of service %s", p.Cohort, p.Stable)
+	}
+
+	return nil
+}
+
+// IsActive tells whether the policy sends anything to a canary.
+func (p TrafficPolicy) IsActive() bool {
+	return p.Canary != ""
+}
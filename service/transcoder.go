@@ -0,0 +1,431 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	protov1 "github.com/golang/protobuf/proto"
+	"go.elastic.co/apm/module/apmgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/uzzeet/uzzeet-gateway/libs/helper/logger"
+)
+
+const (
+	anyMessageName   = "google.protobuf.Any"
+	typeURLPrefix    = "type.googleapis.com/"
+	structTypeURL    = typeURLPrefix + "google.protobuf.Struct"
+	listValueTypeURL = typeURLPrefix + "google.protobuf.ListValue"
+	valueTypeURL     = typeURLPrefix + "google.protobuf.Value"
+)
+
+// transcoder exposes methods of typed gRPC services as REST endpoints, requests and responses are
+// converted between JSON and protobuf using the descriptors registered by the packets package.
+type transcoder struct {
+	bindings []*transcodeBinding
+}
+
+type transcodeBinding struct {
+	Binding
+	fullMethod string
+	method     protoreflect.MethodDescriptor
+	rule       *regexp.Regexp
+	params     []string
+}
+
+func newTranscodeComposite(connURL string, cfg Config) (*Composite, error) {
+	logger.Infof("connecting transcode composite %s(%s)", cfg.Key, connURL)
+
+	t, err := newTranscoder(cfg.Bindings)
+	if err != nil {
+		return nil, fmt.Errorf("while preparing bindings of service %s: %v", cfg.Key, err)
+	}
+
+	conn, err := grpc.Dial(
+		connURL,
+		append([]grpc.DialOption{
+			grpc.WithInsecure(),
+			grpc.WithUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor()),
+		}, cfg.DialOptions()...)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("while dialing server: %v", err)
+	}
+
+	c := &Composite{
+		Key:        cfg.Key,
+		Endpoint:   cfg.gatewayEndpoint,
+		Connection: conn,
+		cfg:        cfg,
+		transcoder: t,
+	}
+	c.policy.Store(t.policy())
+
+	return c, nil
+}
+
+func newTranscoder(bindings []Binding) (*transcoder, error) {
+	t := &transcoder{}
+	for _, each := range bindings {
+		tokens := strings.Split(strings.Trim(each.RPC, "/"), "/")
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("invalid rpc %s, expecting package.Service/Method", each.RPC)
+		}
+
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(tokens[0]))
+		if err != nil {
+			return nil, fmt.Errorf("while looking up service %s: %v", tokens[0], err)
+		}
+
+		sd, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", tokens[0])
+		}
+
+		md := sd.Methods().ByName(protoreflect.Name(tokens[1]))
+		if md == nil {
+			return nil, fmt.Errorf("service %s has no method %s", tokens[0], tokens[1])
+		}
+
+		if md.IsStreamingClient() || md.IsStreamingServer() {
+			return nil, fmt.Errorf("streaming method %s can't be transcoded", each.RPC)
+		}
+
+		rule, params, err := compileTemplate(each.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, param := range params {
+			if findField(md.Input().Fields(), param) == nil {
+				return nil, fmt.Errorf("%s has no field %s", md.Input().FullName(), param)
+			}
+		}
+
+		each.Method = strings.ToUpper(each.Method)
+		if each.Method == "" {
+			each.Method = http.MethodGet
+		}
+
+		t.bindings = append(t.bindings, &transcodeBinding{
+			Binding:    each,
+			fullMethod: fmt.Sprintf("/%s/%s", tokens[0], tokens[1]),
+			method:     md,
+			rule:       rule,
+			params:     params,
+		})
+	}
+
+	return t, nil
+}
+
+// policy describes the bindings the same way a handshake describes gateway services, so that
+// authorization and route validation work unchanged for transcoded services.
+func (t *transcoder) policy() *routePolicy {
+	p := &routePolicy{
+		protectedRoutes: make(map[string][]protectedRoute),
+		routes:          []RouteInfo{},
+	}
+
+	for _, each := range t.bindings {
+		if each.Auth != "" {
+			p.protectedRoutes[each.Method] = append(p.protectedRoutes[each.Method], protectedRoute{
+				pattern: each.rule,
+				method:  each.Auth,
+			})
+		}
+
+		p.routes = append(p.routes, RouteInfo{
+			Method:   each.Method,
+			Template: fmt.Sprintf("/%s", strings.Trim(each.Path, "/")),
+			Params:   each.params,
+			Auth:     each.Auth,
+			Metas: map[string]string{
+				"rpc": each.fullMethod,
+			},
+			rule: each.rule,
+		})
+	}
+
+	return p
+}
+
+func (t *transcoder) match(method string, path string) (*transcodeBinding, map[string]string) {
+	for _, each := range t.bindings {
+		if each.Method != method {
+			continue
+		}
+
+		ss := each.rule.FindStringSubmatch(path)
+		if ss == nil {
+			continue
+		}
+
+		params := make(map[string]string)
+		for index, key := range each.params {
+			params[key] = ss[index+1]
+		}
+
+		return each, params
+	}
+
+	return nil, nil
+}
+
+// IsTranscoded tells whether the composite is a typed gRPC service exposed through transcoding.
+func (c *Composite) IsTranscoded() bool {
+	return c.transcoder != nil
+}
+
+// Transcode converts the REST request into the bound gRPC method, invokes it and returns the
+// HTTP status along with the JSON encoded response message. Errors are gRPC statuses.
+func (c *Composite) Transcode(ctx context.Context, method string, path string, query url.Values, body []byte) (int, json.RawMessage, error) {
+	defer c.Track()()
+
+	binding, params := c.transcoder.match(method, path)
+	if binding == nil {
+		return 0, nil, status.Errorf(codes.NotFound, "no binding for %s %s", method, path)
+	}
+
+	in, err := binding.request(params, query, body)
+	if err != nil {
+		return 0, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	out := dynamicpb.NewMessage(binding.method.Output())
+	err = c.Connection.Invoke(ctx, binding.fullMethod, protov1.MessageV1(in), protov1.MessageV1(out))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	res, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(out)
+	if err != nil {
+		return 0, nil, status.Errorf(codes.Internal, "while marshaling response: %v", err)
+	}
+
+	var obj map[string]interface{}
+	err = json.Unmarshal(res, &obj)
+	if err != nil {
+		return 0, nil, status.Errorf(codes.Internal, "while unmarshaling response: %v", err)
+	}
+
+	unwrapAny(binding.method.Output(), obj)
+	res, err = json.Marshal(obj)
+	if err != nil {
+		return 0, nil, status.Errorf(codes.Internal, "while marshaling response: %v", err)
+	}
+
+	code := http.StatusOK
+	if fd := binding.method.Output().Fields().ByName("Status"); fd != nil && fd.Kind() == protoreflect.Int32Kind {
+		if v := int(out.Get(fd).Int()); v >= 100 && v <= 599 {
+			code = v
+		}
+	}
+
+	return code, res, nil
+}
+
+func (b *transcodeBinding) request(params map[string]string, query url.Values, body []byte) (*dynamicpb.Message, error) {
+	input := b.method.Input()
+	fields := input.Fields()
+
+	obj := make(map[string]interface{})
+	if len(bytes.TrimSpace(body)) > 0 {
+		switch b.Body {
+		case "":
+
+		case "*":
+			err := json.Unmarshal(body, &obj)
+			if err != nil {
+				return nil, fmt.Errorf("invalid json body: %v", err)
+			}
+
+		default:
+			fd := findField(fields, b.Body)
+			if fd == nil {
+				return nil, fmt.Errorf("%s has no field %s", input.FullName(), b.Body)
+			}
+
+			var v interface{}
+			err := json.Unmarshal(body, &v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid json body: %v", err)
+			}
+
+			obj[fd.JSONName()] = v
+		}
+	}
+
+	if b.Body != "*" {
+		for key, vals := range query {
+			fd := findField(fields, key)
+			if fd == nil || fd.Message() != nil || fd.IsMap() || len(vals) == 0 {
+				continue
+			}
+
+			delete(obj, string(fd.Name()))
+			if fd.IsList() {
+				list := []interface{}{}
+				for _, val := range vals {
+					list = append(list, scalarValue(fd, val))
+				}
+
+				obj[fd.JSONName()] = list
+				continue
+			}
+
+			obj[fd.JSONName()] = scalarValue(fd, vals[0])
+		}
+	}
+
+	for key, val := range params {
+		fd := findField(fields, key)
+		delete(obj, string(fd.Name()))
+		obj[fd.JSONName()] = scalarValue(fd, val)
+	}
+
+	wrapAny(input, obj)
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	in := dynamicpb.NewMessage(input)
+	err = protojson.Unmarshal(raw, in)
+	if err != nil {
+		return nil, err
+	}
+
+	return in, nil
+}
+
+func findField(fields protoreflect.FieldDescriptors, name string) protoreflect.FieldDescriptor {
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+
+	if fd := fields.ByJSONName(name); fd != nil {
+		return fd
+	}
+
+	for i := 0; i < fields.Len(); i++ {
+		if strings.EqualFold(string(fields.Get(i).Name()), name) {
+			return fields.Get(i)
+		}
+	}
+
+	return nil
+}
+
+func scalarValue(fd protoreflect.FieldDescriptor, val string) interface{} {
+	if fd.Kind() == protoreflect.BoolKind {
+		if v, err := strconv.ParseBool(val); err == nil {
+			return v
+		}
+	}
+
+	return val
+}
+
+// wrapAny lets clients send plain JSON for google.protobuf.Any fields, values without @type are
+// packed as google.protobuf.Struct, ListValue or Value depending on their shape.
+func wrapAny(md protoreflect.MessageDescriptor, obj map[string]interface{}) {
+	for key, val := range obj {
+		fd := findField(md.Fields(), key)
+		if fd == nil || fd.Message() == nil || fd.IsMap() {
+			continue
+		}
+
+		wrap := func(v interface{}) interface{} {
+			if fd.Message().FullName() != anyMessageName {
+				if m, ok := v.(map[string]interface{}); ok {
+					wrapAny(fd.Message(), m)
+				}
+
+				return v
+			}
+
+			switch vx := v.(type) {
+			case nil:
+				return v
+
+			case map[string]interface{}:
+				if _, ok := vx["@type"]; ok {
+					return v
+				}
+
+				return map[string]interface{}{"@type": structTypeURL, "value": vx}
+
+			case []interface{}:
+				return map[string]interface{}{"@type": listValueTypeURL, "value": vx}
+
+			default:
+				return map[string]interface{}{"@type": valueTypeURL, "value": vx}
+			}
+		}
+
+		if list, ok := val.([]interface{}); ok && fd.IsList() {
+			for i := range list {
+				list[i] = wrap(list[i])
+			}
+
+			continue
+		}
+
+		obj[key] = wrap(val)
+	}
+}
+
+// unwrapAny is the counterpart of wrapAny for responses.
+func unwrapAny(md protoreflect.MessageDescriptor, obj map[string]interface{}) {
+	for key, val := range obj {
+		fd := findField(md.Fields(), key)
+		if fd == nil || fd.Message() == nil || fd.IsMap() {
+			continue
+		}
+
+		unwrap := func(v interface{}) interface{} {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+
+			if fd.Message().FullName() != anyMessageName {
+				unwrapAny(fd.Message(), m)
+				return v
+			}
+
+			switch m["@type"] {
+			case structTypeURL, listValueTypeURL, valueTypeURL:
+				return m["value"]
+			}
+
+			return v
+		}
+
+		if list, ok := val.([]interface{}); ok && fd.IsList() {
+			for i := range list {
+				list[i] = unwrap(list[i])
+			}
+
+			continue
+		}
+
+		obj[key] = unwrap(val)
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.elastic.co/apm/module/apmhttp"
+
+	"github.com/uzzeet/uzzeet-gateway/libs"
+	"github.com/uzzeet/uzzeet-gateway/libs/helper"
+)
+
+var (
+	// httpTransport is shared by every HTTP composite so that upstream connections are pooled
+	// across requests instead of being dialed for each of them.
+	httpTransport = newHttpTransport(nil)
+
+	// unixTransports holds one pool per socket path, since the socket is chosen by the dialer.
+	unixTransports sync.Map
+)
+
+func newHttpTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	if dial == nil {
+		dial = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+
+	return &http.Transport{
+		DialContext:           dial,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableCompression:    true,
+	}
+}
+
+// Target is the base URL of an HTTP composite, services on a unix socket are addressed by key.
+func (c *Composite) Target() *url.URL {
+	host := c.Url
+	if c.cfg.IsUnix() {
+		host = c.cfg.Key
+	}
+
+	return &url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+}
+
+// Transport returns the pooled transport used to reach an HTTP composite, traced like the
+// gRPC connections are.
+func (c *Composite) Transport() http.RoundTripper {
+	if !c.cfg.IsUnix() {
+		return apmhttp.WrapRoundTripper(httpTransport)
+	}
+
+	cfg := c.cfg
+	transport, ok := unixTransports.Load(cfg.Socket)
+	if !ok {
+		transport, _ = unixTransports.LoadOrStore(cfg.Socket, newHttpTransport(func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return cfg.dialUnix(ctx, cfg.Socket)
+		}))
+	}
+
+	return apmhttp.WrapRoundTripper(transport.(*http.Transport))
+}
+
+// SignIdentity signs the authorization info sent to an HTTP composite, it returns an empty string
+// when the gateway has no identity secret.
+func (c *Composite) SignIdentity(authInfo string) string {
+	secret := helper.Env(libs.AppIdentitySecret, "")
+	if secret == "" {
+		return ""
+	}
+
+	return signIdentity(secret, authInfo)
+}